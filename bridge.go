@@ -0,0 +1,161 @@
+package markup
+
+import (
+	_ "embed"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"golang.org/x/net/websocket"
+)
+
+// Bridge is an http.Handler that connects the components mounted in Env to
+// the browsers that display them.
+//
+// A GET request serves a JavaScript runtime that implements CallGoHandler,
+// the function called by the event handlers written by TagEncoder. It should
+// be included in the pages that display the components:
+//
+//	<script src="/path/to/bridge"></script>
+//
+// The runtime opens a WebSocket connection to the same URL. Each event is
+// sent through it: the targeted component is resolved with Env.Component, the
+// event is passed to CallOrAssign, the component is marked as dirty and the
+// environment is flushed, which also updates the components whose callbacks
+// were called. The resulting syncs are sent back as WireSync values, applied
+// to the DOM and dispatched in the browser as a "markup:syncs" event on
+// window. When the flush fails, the response contains the error and the
+// syncs returned by Env.Flush, which rebuild the component that failed from
+// its root.
+//
+// Connections are only accepted from pages with the same origin as the
+// bridge, or with one of AllowedOrigins.
+type Bridge struct {
+	Env Env
+
+	// AllowedOrigins contains the other origins, like https://example.com,
+	// allowed to open a connection.
+	AllowedOrigins []string
+}
+
+func (b *Bridge) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		s := websocket.Server{
+			Handshake: b.handshake,
+			Handler:   b.serveConn,
+		}
+		s.ServeHTTP(w, r)
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/javascript; charset=utf-8")
+	io.WriteString(w, runtimeJS)
+}
+
+// handshake rejects the connections that are not opened from the origin of
+// the bridge or from an allowed origin.
+func (b *Bridge) handshake(config *websocket.Config, r *http.Request) (err error) {
+	if config.Origin, err = websocket.Origin(config, r); err != nil {
+		return err
+	}
+	if config.Origin == nil {
+		return errors.New("fail to handshake: origin is missing")
+	}
+
+	if strings.EqualFold(config.Origin.Host, r.Host) {
+		return nil
+	}
+
+	origin := config.Origin.Scheme + "://" + config.Origin.Host
+	for _, allowed := range b.AllowedOrigins {
+		if strings.EqualFold(origin, strings.TrimSuffix(allowed, "/")) {
+			return nil
+		}
+	}
+	return errors.Errorf("fail to handshake: origin %s is not allowed", origin)
+}
+
+func (b *Bridge) serveConn(conn *websocket.Conn) {
+	defer conn.Close()
+
+	// The response is computed in the dispatch loop and sent from the
+	// connection goroutine, so a slow client doesn't block the other
+	// dispatched funcs. The buffer lets the dispatched func return without
+	// waiting for the connection goroutine.
+	responses := make(chan bridgeResponse, 1)
+
+	for {
+		var ev bridgeEvent
+		if err := websocket.JSON.Receive(conn, &ev); err != nil {
+			return
+		}
+
+		b.Env.Dispatch(func() {
+			responses <- b.handle(ev)
+		})
+
+		if err := websocket.JSON.Send(conn, <-responses); err != nil {
+			return
+		}
+	}
+}
+
+func (b *Bridge) handle(ev bridgeEvent) (res bridgeResponse) {
+	c, err := b.Env.Component(ev.CompoID)
+	if err != nil {
+		res.Error = errors.Wrapf(err, "fail to handle %s", ev.Target).Error()
+		return
+	}
+
+	if err = CallOrAssign(c, ev.Target, ev.Arg); err != nil {
+		res.Error = errors.Wrapf(err, "fail to handle %s", ev.Target).Error()
+		return
+	}
+
+	// c is flushed along with the components whose methods were called as
+	// callbacks by the handler.
+	b.Env.MarkDirty(c)
+
+	syncs, err := b.Env.Flush()
+	if err != nil {
+		res.Error = errors.Wrapf(err, "fail to handle %s", ev.Target).Error()
+
+		// syncs ends with the operation that rebuilds the component that
+		// failed from its root.
+		res.Syncs, _ = NewWireSyncs(b.Env, syncs)
+		return
+	}
+
+	if res.Syncs, err = NewWireSyncs(b.Env, syncs); err != nil {
+		res.Error = errors.Wrapf(err, "fail to handle %s", ev.Target).Error()
+	}
+	return
+}
+
+// bridgeEvent is the message sent by the JavaScript runtime when
+// CallGoHandler is called.
+// Arg is the JSON value passed to CallOrAssign.
+type bridgeEvent struct {
+	CompoID uuid.UUID
+	Target  string
+	Arg     string
+}
+
+// bridgeResponse is the message sent to the JavaScript runtime once an event
+// has been handled.
+type bridgeResponse struct {
+	Syncs []WireSync `json:",omitempty"`
+	Error string     `json:",omitempty"`
+}
+
+// runtimeJS is the JavaScript runtime served by Bridge.
+//
+//go:embed markup.js
+var runtimeJS string
@@ -0,0 +1,240 @@
+package markup
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"golang.org/x/net/websocket"
+)
+
+type BridgeFailing struct {
+	Fail bool
+}
+
+func (c *BridgeFailing) Render() string {
+	return `<div>{{if .Fail}}{{.Missing}}{{end}}</div>`
+}
+
+func TestBridge(t *testing.T) {
+	b := NewCompoBuilder()
+	b.Register(&Hello{})
+	b.Register(&World{})
+	b.Register(&Picker{})
+
+	env := NewEnv(b)
+
+	hello := &Hello{}
+	root, err := env.Mount(hello)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.Dismount(hello)
+
+	failing := &BridgeFailing{}
+	failingRoot, err := env.Mount(failing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.Dismount(failing)
+
+	page := &PickerStatePage{}
+	pageRoot, err := env.Mount(page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.Dismount(page)
+
+	server := httptest.NewServer(&Bridge{Env: env})
+	defer server.Close()
+
+	tests := []struct {
+		name string
+		test func(t *testing.T)
+	}{
+		{
+			name: "serve runtime",
+			test: func(t *testing.T) { testBridgeRuntime(t, server.URL) },
+		},
+		{
+			name: "handle event",
+			test: func(t *testing.T) {
+				testBridgeEvent(t, server.URL, bridgeEvent{
+					CompoID: root.CompoID,
+					Target:  "Greeting",
+					Arg:     `"Hi"`,
+				}, 1)
+			},
+		},
+		{
+			name: "handle event for not mounted component",
+			test: func(t *testing.T) {
+				testBridgeEvent(t, server.URL, bridgeEvent{
+					CompoID: uuid.New(),
+					Target:  "Greeting",
+					Arg:     `"Hi"`,
+				}, -1)
+			},
+		},
+		{
+			name: "handle event with bad argument",
+			test: func(t *testing.T) {
+				testBridgeEvent(t, server.URL, bridgeEvent{
+					CompoID: root.CompoID,
+					Target:  "Greeting",
+					Arg:     `42`,
+				}, -1)
+			},
+		},
+		{
+			name: "handle event that calls a callback",
+			test: func(t *testing.T) {
+				testBridgeEvent(t, server.URL, bridgeEvent{
+					CompoID: pageRoot.Children[1].ID,
+					Target:  "Select",
+					Arg:     `"b"`,
+				}, 1)
+
+				if page.Selected != "b" {
+					t.Fatal("page selected item should be b:", page.Selected)
+				}
+			},
+		},
+		{
+			name: "handle event with failing update",
+			test: func(t *testing.T) {
+				testBridgeFailingUpdate(t, server.URL, failingRoot)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, test.test)
+	}
+}
+
+func testBridgeFailingUpdate(t *testing.T, url string, root Tag) {
+	conn, err := websocket.Dial("ws"+strings.TrimPrefix(url, "http"), "", url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	ev := bridgeEvent{
+		CompoID: root.CompoID,
+		Target:  "Fail",
+		Arg:     "true",
+	}
+	if err = websocket.JSON.Send(conn, ev); err != nil {
+		t.Fatal(err)
+	}
+
+	var res bridgeResponse
+	if err = websocket.JSON.Receive(conn, &res); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.Error) == 0 {
+		t.Fatal("response should contain an error")
+	}
+	if l := len(res.Syncs); l != 1 {
+		t.Fatal("response should contain 1 sync:", l)
+	}
+	if s := res.Syncs[0]; s.Op != "tag" || !s.Full || s.ID != root.ID.String() || s.Node == nil {
+		t.Errorf("sync should rebuild the component root: %+v", s)
+	}
+}
+
+func TestBridgeOrigin(t *testing.T) {
+	env := NewEnv(NewCompoBuilder())
+
+	server := httptest.NewServer(&Bridge{
+		Env:            env,
+		AllowedOrigins: []string{"https://app.example.com/"},
+	})
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	tests := []struct {
+		origin  string
+		allowed bool
+	}{
+		{origin: server.URL, allowed: true},
+		{origin: "https://app.example.com", allowed: true},
+		{origin: "http://app.example.com", allowed: false},
+		{origin: "https://evil.example.com", allowed: false},
+	}
+
+	for _, test := range tests {
+		conn, err := websocket.Dial(wsURL, "", test.origin)
+		if test.allowed && err != nil {
+			t.Errorf("connection from %s should be allowed: %v", test.origin, err)
+		}
+		if !test.allowed && err == nil {
+			t.Errorf("connection from %s should not be allowed", test.origin)
+		}
+		if err == nil {
+			conn.Close()
+		}
+	}
+}
+
+func testBridgeRuntime(t *testing.T, url string) {
+	res, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if ctype := res.Header.Get("Content-Type"); !strings.HasPrefix(ctype, "application/javascript") {
+		t.Fatal("content type should be application/javascript:", ctype)
+	}
+
+	js, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(js), "CallGoHandler") {
+		t.Fatal("runtime should define CallGoHandler")
+	}
+}
+
+// testBridgeEvent sends ev to the bridge and checks the response contains
+// syncCount syncs. A negative syncCount means an error is expected.
+func testBridgeEvent(t *testing.T, url string, ev bridgeEvent, syncCount int) {
+	wsURL := "ws" + strings.TrimPrefix(url, "http")
+
+	conn, err := websocket.Dial(wsURL, "", url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if err = websocket.JSON.Send(conn, ev); err != nil {
+		t.Fatal(err)
+	}
+
+	var res bridgeResponse
+	if err = websocket.JSON.Receive(conn, &res); err != nil {
+		t.Fatal(err)
+	}
+
+	if syncCount < 0 {
+		if len(res.Error) == 0 {
+			t.Fatal("response should contain an error")
+		}
+		t.Log(res.Error)
+		return
+	}
+
+	if len(res.Error) != 0 {
+		t.Fatal(res.Error)
+	}
+	if l := len(res.Syncs); l != syncCount {
+		t.Fatalf("response should contain %v syncs: %v", syncCount, l)
+	}
+}
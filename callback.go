@@ -0,0 +1,63 @@
+package markup
+
+import (
+	"reflect"
+
+	"github.com/pkg/errors"
+)
+
+// methodRef refers to the method named name of the component that rendered a
+// component tag. It is bound to the func fields of the nested component.
+type methodRef struct {
+	owner Componer
+	name  string
+}
+
+// methodRefs sets the attributes of the component tag t that name a method
+// of owner as method references.
+func methodRefs(t *Tag, owner Componer) {
+	v := reflect.ValueOf(owner)
+
+	for name, val := range t.Attrs {
+		if _, ok := t.values[name]; ok || len(val) == 0 {
+			continue
+		}
+		if !v.MethodByName(val).IsValid() {
+			continue
+		}
+
+		if t.values == nil {
+			t.values = make(map[string]interface{})
+		}
+		t.values[name] = methodRef{
+			owner: owner,
+			name:  val,
+		}
+	}
+}
+
+// bind sets the func field f to the method referred by m. Calling f marks the
+// owner as dirty in store, when store is not nil. It returns an error if the
+// method type is not assignable to the field.
+func (m methodRef) bind(f reflect.Value, store *contextStore) error {
+	method := reflect.ValueOf(m.owner).MethodByName(m.name)
+	if !method.Type().AssignableTo(f.Type()) {
+		return errors.Errorf("%T.%s is %v, not %v", m.owner, m.name, method.Type(), f.Type())
+	}
+
+	if store == nil {
+		f.Set(method)
+		return nil
+	}
+
+	variadic := f.Type().IsVariadic()
+	f.Set(reflect.MakeFunc(f.Type(), func(args []reflect.Value) []reflect.Value {
+		defer store.markDirty(m.owner)
+
+		if variadic {
+			return method.CallSlice(args)
+		}
+		return method.Call(args)
+	}))
+	return nil
+}
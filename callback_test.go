@@ -0,0 +1,192 @@
+package markup
+
+import (
+	"strings"
+	"testing"
+)
+
+type SelectHandler func(item string)
+
+type Picker struct {
+	Label    string
+	OnSelect SelectHandler `markup:"onselect"`
+	OnClear  func()        `markup:"onclear,omitempty"`
+}
+
+func (p *Picker) Render() string {
+	return `<button onclick="Select">{{.Label}}</button>`
+}
+
+func (p *Picker) Select(item string) {
+	p.OnSelect(item)
+}
+
+type PickerPage struct {
+	Selected string
+	Cleared  bool
+}
+
+func (p *PickerPage) Render() string {
+	return `
+<div>
+	<markup.picker label="HandleSelect" onselect="HandleSelect" onclear="HandleClear">
+</div>
+	`
+}
+
+func (p *PickerPage) HandleSelect(item string) {
+	p.Selected = item
+}
+
+func (p *PickerPage) HandleClear() {
+	p.Cleared = true
+}
+
+type PickerBadPage struct{}
+
+func (p *PickerBadPage) Render() string {
+	return `<div><markup.picker onselect="HandleSelect"></div>`
+}
+
+func (p *PickerBadPage) HandleSelect(n int) {}
+
+type PickerNoMethodPage struct {
+	Name string
+}
+
+func (p *PickerNoMethodPage) Render() string {
+	return `<div><markup.picker onselect="HandleSelect"></div>`
+}
+
+func TestCallback(t *testing.T) {
+	b := NewCompoBuilder()
+	b.Register(&Picker{})
+
+	env := newEnv(b)
+	p := &PickerPage{}
+
+	if _, err := env.Mount(p); err != nil {
+		t.Fatal(err)
+	}
+	defer env.Dismount(p)
+
+	var picker *Picker
+	for _, c := range env.components {
+		if c, ok := c.(*Picker); ok {
+			picker = c
+		}
+	}
+
+	if picker.Label != "HandleSelect" {
+		t.Fatal("picker label should be HandleSelect:", picker.Label)
+	}
+
+	if err := CallOrAssign(picker, "Select", `"b"`); err != nil {
+		t.Fatal(err)
+	}
+	if p.Selected != "b" {
+		t.Fatal("page selected item should be b:", p.Selected)
+	}
+
+	picker.OnClear()
+	if !p.Cleared {
+		t.Fatal("page should be cleared")
+	}
+
+	syncs, err := env.Update(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := len(syncs); l != 0 {
+		t.Fatal("syncs should be empty:", l)
+	}
+}
+
+type PickerStatePage struct {
+	Selected string
+}
+
+func (p *PickerStatePage) Render() string {
+	return `
+<div>
+	<p>{{.Selected}}</p>
+	<markup.picker onselect="HandleSelect">
+</div>
+	`
+}
+
+func (p *PickerStatePage) HandleSelect(item string) {
+	p.Selected = item
+}
+
+func TestCallbackFlush(t *testing.T) {
+	b := NewCompoBuilder()
+	b.Register(&Picker{})
+
+	env := newEnv(b)
+	p := &PickerStatePage{}
+
+	root, err := env.Mount(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.Dismount(p)
+
+	picker, err := env.Component(root.Children[1].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = CallOrAssign(picker, "Select", `"b"`); err != nil {
+		t.Fatal(err)
+	}
+	env.MarkDirty(picker)
+
+	syncs, err := env.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(syncs) == 0 {
+		t.Fatal("syncs should not be empty")
+	}
+
+	root, _ = env.Root(p)
+	if text := root.Children[0].Children[0].Text; text != "b" {
+		t.Fatal("page should have been rendered with the selected item:", text)
+	}
+}
+
+func TestCallbackErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		compo  Componer
+		reason string
+	}{
+		{
+			name:   "method with bad type",
+			compo:  &PickerBadPage{},
+			reason: "func(int), not markup.SelectHandler",
+		},
+		{
+			name:   "missing method",
+			compo:  &PickerNoMethodPage{},
+			reason: "HandleSelect is not a method",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b := NewCompoBuilder()
+			b.Register(&Picker{})
+
+			env := newEnv(b)
+			_, err := env.Mount(test.compo)
+			if err == nil {
+				t.Fatal("mounting the page should return an error")
+			}
+			if !strings.Contains(err.Error(), test.reason) {
+				t.Fatalf("error should contain %q: %v", test.reason, err)
+			}
+		})
+	}
+}
@@ -4,24 +4,94 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	htmltemplate "html/template"
+	"io"
 	"net/url"
 	"reflect"
+	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"text/template"
 	"time"
 
 	"github.com/pkg/errors"
+	"golang.org/x/net/html"
 )
 
 // Componer is the interface that describes a component.
 // Should be implemented on a non empty struct pointer.
+//
+// The attributes of the tag that describes a component are mapped to its
+// exported fields. An attribute is mapped to the field with the same name in
+// lower case. The mapping can be changed with the markup struct tag:
+//
+//	UserID string `markup:"data-user-id"`        // Mapped from data-user-id.
+//	Label  string `markup:"aria-label,required"` // Mount fails without aria-label.
+//	Hidden bool   `markup:",omitempty"`          // Unchanged when hidden is absent or empty.
+//	Cache  string `markup:"-"`                   // Not mapped.
+//	Size   int    `markup:"size,default=10"`     // Set to 10 without size.
+//
+// Fields without a mapped attribute are set to their default value if they
+// have one. Otherwise they are left unchanged, except bool fields that are set
+// to false unless they are marked omitempty. The default option must be the
+// last one of the tag.
+//
+// Exported fields of embedded structs are mapped as if they were fields of the
+// component. When fields are mapped to the same attribute, the less nested one
+// takes precedence. Mapping fails when they are nested at the same depth.
+//
+// Values are converted with the converters registered with RegisterConverter
+// or with the UnmarshalText method of fields that implement
+// encoding.TextUnmarshaler. Other values are parsed according to the kind of
+// the field, or decoded as JSON.
+//
+// Components that implement Validator are validated once their fields are
+// mapped.
+//
+// The ref template function passes a value by reference to a nested
+// component. The value is assigned as is to the field, which must be of an
+// assignable type:
+//
+//	<markup.list items="{{ref .Items}}" selected="{{ref .Selected}}">
+//
+// The attribute is then set to markup-ref in the attributes passed to the
+// lifecycle hooks.
+// A component with values passed by reference gets its fields mapped again
+// when they change. Pointers, maps, slices and channels change when they refer
+// to another memory. Functions change on every rendering.
+//
+// Func fields are callbacks that let a component notify the component that
+// rendered it. They are bound to the method named by the attribute, which
+// must be assignable to the field:
+//
+//	OnSelect func(item string) `markup:"onselect"` // onselect="HandleSelect"
+//
+// Mount fails when the attribute does not name a method of the component
+// that rendered the tag or when the method type does not match the field.
+// Calling a callback marks the component that rendered the tag as dirty: it
+// is updated by the next call to Env.Flush.
+//
+// Component tags that are closed have children, which are projected into the
+// slot tags of the component template. A slot without name receives the
+// children without slot attribute and a slot named header receives the
+// children with slot="header":
+//
+//	<markup.card>
+//		<h1 slot="header">{{.Title}}</h1>
+//		<p onclick="OnClick">{{.Text}}</p>
+//	</markup.card>
+//
+// Projected tags belong to the component that rendered them: their event
+// handlers call its methods and their slots are filled with its own
+// projected children.
 type Componer interface {
 	// Render should return a string describing the component with HTML5
 	// standard.
-	// It support Golang template/text API.
+	// It support Golang html/template API, or template/text API when the
+	// component is a RawRenderer.
 	// Pipeline is based on the component struct.
-	// See https://golang.org/pkg/text/template for more informations.
+	// See https://golang.org/pkg/html/template for more informations.
 	Render() string
 }
 
@@ -37,6 +107,92 @@ type Dismounter interface {
 	OnDismount()
 }
 
+// Updater is the interface that wraps OnUpdate method.
+// OnUpdate is called after a component has been rendered again and its tree
+// synchronized. Nested components updated as part of a component have their
+// OnUpdate method called before the one of the component.
+type Updater interface {
+	OnUpdate()
+}
+
+// UpdateDecider is the interface that wraps ShouldUpdate method.
+// ShouldUpdate is called when the attributes of a nested component change,
+// after they have been mapped to its fields and after OnPropsChange. The
+// component is rendered again only if it returns true.
+// It is not called when the component is updated with Env.Update or
+// Env.Flush, or when its projected children change.
+type UpdateDecider interface {
+	ShouldUpdate(oldAttrs, newAttrs AttrMap) bool
+}
+
+// PropsObserver is the interface that wraps OnPropsChange method.
+// OnPropsChange is called when the attributes of a nested component change,
+// after they have been mapped to its fields and before it is rendered again.
+type PropsObserver interface {
+	OnPropsChange(oldAttrs, newAttrs AttrMap)
+}
+
+// ErrorBoundary is the interface that wraps OnError method.
+// OnError is called when a component nested in an error boundary fails to be
+// decoded, to get its fields mapped or to be mounted, whether it is during
+// the mount or the update of the error boundary or of the failing component.
+// The error boundary is then rendered again and should describe a fallback
+// that does not contain the failing component, for example by setting a
+// field in OnError.
+// Errors are handled by the nearest error boundary. The mount or the update
+// fails only if the fallback fails too.
+type ErrorBoundary interface {
+	OnError(err error)
+}
+
+// Validator is the interface that wraps Validate method.
+// Validate is called after the attributes of a component are mapped to its
+// fields, when it is mounted as a child of another component and when its
+// attributes change. A returned error prevents the mount or the update.
+// Errors should be PropError when they are caused by an attribute.
+type Validator interface {
+	Validate() error
+}
+
+// PropError describes an attribute with an invalid value.
+type PropError struct {
+	// Component is the type of the component that rejected the attribute.
+	// It is set by the environment when empty.
+	Component string
+
+	// Attr is the name of the attribute.
+	Attr string
+
+	// Value is the value of the attribute.
+	// It is set by the environment when empty.
+	Value string
+
+	// Reason describes why the value is invalid.
+	Reason string
+}
+
+func (e *PropError) Error() string {
+	return fmt.Sprintf(`%s: invalid %s="%s": %s`, e.Component, e.Attr, e.Value, e.Reason)
+}
+
+// newPropError returns the error err returned by the Validate method of c,
+// completed with the component type and the attribute value when it is a
+// PropError.
+func newPropError(c Componer, attrs AttrMap, err error) error {
+	perr, ok := err.(*PropError)
+	if !ok {
+		return errors.Wrapf(err, "fail to validate %T", c)
+	}
+
+	if len(perr.Component) == 0 {
+		perr.Component = fmt.Sprintf("%T", c)
+	}
+	if len(perr.Value) == 0 {
+		perr.Value = attrs[perr.Attr]
+	}
+	return perr
+}
+
 // Navigator is the interface that wraps OnNavigate method.
 // OnNavigate is called when a component is navigated to.
 type Navigator interface {
@@ -48,13 +204,36 @@ type Mapper interface {
 	// Allows to add custom functions to the template used to render the
 	// component.
 	//
-	// Funcs named json and time are reserved. They handle json conversion and
-	// time format.
+	// Funcs named json, time and ref are reserved. They handle json
+	// conversion, time format and values passed by reference.
 	// They can't be overloaded.
 	// See https://golang.org/pkg/text/template/#Template.Funcs for more details.
 	FuncMaps() template.FuncMap
 }
 
+// DynamicRenderer is the interface that wraps DynamicRender method.
+// DynamicRender reports whether the template returned by Render changes
+// between renderings.
+// Templates are parsed once per component type and cached. Components that
+// build their template dynamically should implement DynamicRenderer to have
+// their template parsed at each rendering instead.
+type DynamicRenderer interface {
+	DynamicRender() bool
+}
+
+// RawRenderer is the interface that wraps RawRender method.
+// RawRender reports whether the template returned by Render should be executed
+// without contextual escaping.
+// Templates are executed with html/template semantics by default: values are
+// escaped according to the text, attribute or URL context they are written
+// in. Values of event handler attributes, which name methods or fields, are
+// escaped as regular attribute values. Components that implement RawRenderer
+// and return true have their template executed with text/template semantics,
+// which writes values verbatim.
+type RawRenderer interface {
+	RawRender() bool
+}
+
 // ZeroCompo is the type to redefine when writing an empty component.
 // Every instances of an empty struct is given the same memory address, which
 // causes problem for indexing components.
@@ -80,42 +259,254 @@ func ensureValidComponent(c Componer) error {
 }
 
 func mapComponentFields(c Componer, attrs AttrMap) error {
-	if len(attrs) == 0 {
-		return nil
-	}
+	return mapComponentProps(c, attrs, nil, nil)
+}
 
+// mapComponentProps maps attrs to the fields of c. Attributes that have a
+// value in values are passed by reference: the value is assigned to the field
+// without conversion. The owners of the methods bound to func fields are
+// marked as dirty in store when they are called.
+func mapComponentProps(c Componer, attrs AttrMap, values map[string]interface{}, store *contextStore) error {
 	v := reflect.ValueOf(c).Elem()
-	t := v.Type()
+
+	fields, err := componentFields(v.Type())
+	if err != nil {
+		return errors.Wrapf(err, "fail to map %T", c)
+	}
+
+	for _, field := range fields {
+		mapping := field.mapping
+
+		key := mapping.attr
+		val, ok := attrs[key]
+		if ok && len(val) == 0 && mapping.omitempty {
+			ok = false
+		}
+
+		if !ok {
+			if mapping.required {
+				return errors.Errorf("fail to map %T.%s: attribute %s is required", c, field.name, key)
+			}
+
+			if mapping.hasDefault {
+				f, _ := fieldByIndex(v, field.index, true)
+				if err := mapComponentField(f, mapping.defaultValue); err != nil {
+					return errors.Wrapf(err, `fail to map default %s="%s" to %T.%s`, key, mapping.defaultValue, c, field.name)
+				}
+				continue
+			}
+
+			if f, ok := fieldByIndex(v, field.index, false); ok && f.Kind() == reflect.Bool && !mapping.omitempty {
+				f.SetBool(false)
+			}
+			continue
+		}
+
+		f, _ := fieldByIndex(v, field.index, true)
+
+		ref, isRef := values[key]
+		if m, ok := ref.(methodRef); ok {
+			if f.Kind() == reflect.Func {
+				if err := m.bind(f, store); err != nil {
+					return errors.Wrapf(err, "fail to bind %s to %T.%s", key, c, field.name)
+				}
+				continue
+			}
+			isRef = false
+		}
+
+		if isRef {
+			if err := mapComponentValue(f, ref); err != nil {
+				return errors.Wrapf(err, "fail to map %s reference to %T.%s", key, c, field.name)
+			}
+			continue
+		}
+
+		if f.Kind() == reflect.Func {
+			return errors.Errorf(`fail to map %s="%s" to %T.%s: %s is not a method of the component that rendered it`, key, val, c, field.name, val)
+		}
+
+		if err := mapComponentField(f, val); err != nil {
+			return errors.Wrapf(err, `fail to map %s="%s" to %T.%s`, key, val, c, field.name)
+		}
+	}
+
+	if validator, ok := c.(Validator); ok {
+		if err := validator.Validate(); err != nil {
+			return newPropError(c, attrs, err)
+		}
+	}
+	return nil
+}
+
+// componentField describes a component field mapped to an attribute.
+type componentField struct {
+	// name is the name of the field, prefixed by the names of the embedded
+	// structs it is promoted from.
+	name    string
+	index   []int
+	mapping fieldMapping
+}
+
+// componentFields returns the fields of the struct type t that are mapped to
+// attributes.
+//
+// Exported fields of embedded structs and pointers to structs are promoted,
+// unless the embedded field is named with the markup struct tag. In that case
+// the embedded field is mapped as a whole.
+// When several fields are mapped to the same attribute, the less nested one
+// is used. err is set if they are nested at the same depth.
+func componentFields(t reflect.Type) (fields []componentField, err error) {
+	var all []componentField
+	collectComponentFields(&all, t, nil, "", map[reflect.Type]bool{})
+
+	attrFields := make(map[string]int, len(all))
+	conflicts := make(map[string]string)
+
+	for _, field := range all {
+		attr := field.mapping.attr
+
+		i, ok := attrFields[attr]
+		if !ok {
+			attrFields[attr] = len(fields)
+			fields = append(fields, field)
+			continue
+		}
+
+		switch {
+		case len(field.index) < len(fields[i].index):
+			fields[i] = field
+			delete(conflicts, attr)
+
+		case len(field.index) == len(fields[i].index):
+			conflicts[attr] = field.name
+		}
+	}
+
+	for _, field := range fields {
+		if name, ok := conflicts[field.mapping.attr]; ok {
+			err = errors.Errorf("fields %s and %s are both mapped to attribute %s", field.name, name, field.mapping.attr)
+			return
+		}
+	}
+	return
+}
+
+func collectComponentFields(fields *[]componentField, t reflect.Type, index []int, prefix string, visited map[reflect.Type]bool) {
+	if visited[t] {
+		return
+	}
+	visited[t] = true
+	defer delete(visited, t)
 
 	for i, numField := 0, t.NumField(); i < numField; i++ {
-		f := v.Field(i)
 		finfo := t.Field(i)
 
-		if finfo.Anonymous {
+		mapping := newFieldMapping(finfo)
+		if mapping.skip {
 			continue
 		}
 
+		findex := make([]int, len(index)+1)
+		copy(findex, index)
+		findex[len(index)] = i
+
+		if finfo.Anonymous && !mapping.named {
+			ft := finfo.Type
+			ptr := ft.Kind() == reflect.Ptr
+			if ptr {
+				ft = ft.Elem()
+			}
+
+			// Pointers to unexported structs can't be allocated.
+			if ft.Kind() == reflect.Struct && !(ptr && len(finfo.PkgPath) != 0) {
+				collectComponentFields(fields, ft, findex, prefix+finfo.Name+".", visited)
+				continue
+			}
+		}
+
 		if len(finfo.PkgPath) != 0 {
 			continue
 		}
 
-		key := strings.ToLower(finfo.Name)
-		val, ok := attrs[key]
-		if !ok {
-			if f.Kind() == reflect.Bool {
-				f.SetBool(false)
+		*fields = append(*fields, componentField{
+			name:    prefix + finfo.Name,
+			index:   findex,
+			mapping: mapping,
+		})
+	}
+}
+
+// fieldByIndex returns the field of the struct v described by index.
+// Nil pointers to embedded structs are allocated when alloc is true.
+// Otherwise ok is false.
+func fieldByIndex(v reflect.Value, index []int, alloc bool) (f reflect.Value, ok bool) {
+	for i, x := range index {
+		if i != 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !alloc {
+					return
+				}
+				v.Set(reflect.New(v.Type().Elem()))
 			}
-			continue
+			v = v.Elem()
 		}
+		v = v.Field(x)
+	}
+	return v, true
+}
 
-		if err := mapComponentField(f, val); err != nil {
-			return errors.Wrapf(err, `fail to map %s="%s" to %T.%s`, key, val, c, finfo.Name)
+// fieldMapping describes how an attribute is mapped to a component field.
+type fieldMapping struct {
+	attr         string
+	named        bool
+	skip         bool
+	omitempty    bool
+	required     bool
+	hasDefault   bool
+	defaultValue string
+}
+
+// newFieldMapping returns the mapping of the field f, as described by its
+// markup struct tag.
+func newFieldMapping(f reflect.StructField) (m fieldMapping) {
+	tag := f.Tag.Get("markup")
+	if tag == "-" {
+		m.skip = true
+		return
+	}
+
+	// The default value is the end of the tag in order to allow commas in it.
+	if i := strings.Index(tag, ",default="); i != -1 {
+		m.hasDefault = true
+		m.defaultValue = tag[i+len(",default="):]
+		tag = tag[:i]
+	}
+
+	opts := strings.Split(tag, ",")
+
+	m.attr = strings.ToLower(opts[0])
+	if m.named = len(m.attr) != 0; !m.named {
+		m.attr = strings.ToLower(f.Name)
+	}
+
+	for _, opt := range opts[1:] {
+		switch opt {
+		case "omitempty":
+			m.omitempty = true
+
+		case "required":
+			m.required = true
 		}
 	}
-	return nil
+	return
 }
 
 func mapComponentField(f reflect.Value, v string) error {
+	if ok, err := convertString(f, v); ok {
+		return err
+	}
+
 	switch f.Kind() {
 	case reflect.String:
 		f.SetString(v)
@@ -159,29 +550,405 @@ func mapComponentField(f reflect.Value, v string) error {
 }
 
 func decodeComponent(c Componer, root *Tag) error {
+	r := c.Render()
+
+	tmpl, err := componentTemplate(c, r)
+	if err != nil {
+		return errors.Wrapf(newTemplateError(c, r, err), "fail to decode %T", c)
+	}
+
+	// Values passed by reference are stored in a table that is specific to
+	// the rendering. ref is bound to it on a copy of the template.
+	refs := &refTable{}
+	if tmpl.refs {
+		refs = newRefTable()
+		if tmpl, err = tmpl.bind(template.FuncMap{"ref": refs.ref}); err != nil {
+			return errors.Wrapf(err, "fail to decode %T", c)
+		}
+	}
+
+	b := bytes.Buffer{}
+	if err = tmpl.Execute(&b, c); err != nil {
+		return errors.Wrapf(newTemplateError(c, r, err), "fail to decode %T", c)
+	}
+
+	dec := NewTagDecoder(&b)
+	if err := dec.Decode(root); err != nil {
+		return errors.Wrapf(err, "fail to decode %T", c)
+	}
+
+	if tmpl.html != nil {
+		restoreEventAttrs(root)
+	}
+
+	if err := refs.resolve(root, c); err != nil {
+		return errors.Wrapf(err, "fail to decode %T", c)
+	}
+	return nil
+}
+
+var templates = templateCache{
+	entries: make(map[reflect.Type]templateCacheEntry),
+}
+
+// componentTemplate returns the parsed template r of c, with the functions
+// returned by its FuncMaps method bound.
+func componentTemplate(c Componer, r string) (parsedTemplate, error) {
 	var funcMap template.FuncMap
 	if mapper, ok := c.(Mapper); ok {
 		funcMap = mapper.FuncMaps()
 	}
-	if len(funcMap) == 0 {
-		funcMap = make(template.FuncMap, 2)
+	customFuncs := len(funcMap) != 0
+
+	raw := false
+	if rawRenderer, ok := c.(RawRenderer); ok {
+		raw = rawRenderer.RawRender()
+	}
+
+	if !customFuncs {
+		funcMap = make(template.FuncMap, 3)
 	}
 	funcMap["json"] = convertToJSON
 	funcMap["time"] = formatTime
+	funcMap["ref"] = unboundRef
 
-	r := c.Render()
-	tmpl := template.Must(template.New(fmt.Sprintf("%T", c)).Funcs(funcMap).Parse(r))
+	// Values returned by json are escaped by html/template.
+	if !raw {
+		funcMap["json"] = convertToUnescapedJSON
+	}
 
-	b := bytes.Buffer{}
-	if err := tmpl.Execute(&b, c); err != nil {
-		return errors.Wrapf(err, "fail to decode %T", c)
+	name := fmt.Sprintf("%T", c)
+
+	if dyn, ok := c.(DynamicRenderer); ok && dyn.DynamicRender() {
+		return parseTemplate(name, r, funcMap, raw)
 	}
 
-	dec := NewTagDecoder(&b)
-	if err := dec.Decode(root); err != nil {
-		return errors.Wrapf(err, "fail to decode %T", c)
+	t := reflect.TypeOf(c)
+
+	if tmpl, ok := templates.get(t, r, funcMap, raw); ok {
+		if !customFuncs {
+			return tmpl, nil
+		}
+
+		// Custom functions can be bound to a component instance. They are
+		// rebound on a copy of the cached template.
+		return tmpl.bind(funcMap)
 	}
-	return nil
+
+	tmpl, err := parseTemplate(name, r, funcMap, raw)
+	if err != nil {
+		return tmpl, err
+	}
+	templates.set(t, r, funcMap, raw, tmpl)
+
+	// An html/template can't be copied once executed. The cached template is
+	// kept unexecuted when it has to be copied to bind custom functions.
+	if customFuncs {
+		return tmpl.bind(funcMap)
+	}
+	return tmpl, nil
+}
+
+// parsedTemplate represents a component template parsed either with
+// text/template or html/template.
+type parsedTemplate struct {
+	text *template.Template
+	html *htmltemplate.Template
+
+	// refs reports whether the template may use the ref function.
+	refs bool
+}
+
+func parseTemplate(name, src string, funcMap template.FuncMap, raw bool) (tmpl parsedTemplate, err error) {
+	tmpl.refs = refUsage.MatchString(src)
+
+	if raw {
+		tmpl.text, err = template.New(name).Funcs(funcMap).Parse(src)
+		return
+	}
+
+	src = escapeEventAttrs(src)
+	tmpl.html, err = htmltemplate.New(name).Funcs(htmltemplate.FuncMap(funcMap)).Parse(src)
+	return
+}
+
+// eventAttrPrefix replaces the on prefix of event handler attributes in
+// templates executed with html/template.
+const eventAttrPrefix = "markup-on"
+
+// escapeEventAttrs renames the event handler attributes of the tags in the
+// template src.
+// html/template escapes the values of attributes starting with on as
+// JavaScript, while they are the names of the methods or fields that handle
+// the events. Renamed attributes are escaped as regular attributes.
+func escapeEventAttrs(src string) string {
+	var b strings.Builder
+	b.Grow(len(src))
+
+	z := html.NewTokenizer(strings.NewReader(src))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+
+		raw := string(z.Raw())
+		if tt == html.StartTagToken || tt == html.SelfClosingTagToken {
+			raw = escapeEventAttrNames(raw)
+		}
+		b.WriteString(raw)
+	}
+	return b.String()
+}
+
+// escapeEventAttrNames renames the event handler attributes of the start tag
+// raw. Attribute values and template actions are left unchanged.
+func escapeEventAttrNames(raw string) string {
+	const (
+		tagName = iota
+		space
+		attrName
+		equal
+		quotedValue
+		unquotedValue
+	)
+
+	var b strings.Builder
+	b.Grow(len(raw) + len(eventAttrPrefix))
+
+	state := tagName
+	var quote byte
+
+	for i := 0; i < len(raw); {
+		if strings.HasPrefix(raw[i:], "{{") {
+			end := strings.Index(raw[i:], "}}")
+			if end == -1 {
+				end = len(raw)
+			} else {
+				end += i + 2
+			}
+			b.WriteString(raw[i:end])
+			i = end
+			continue
+		}
+
+		c := raw[i]
+		switch state {
+		case tagName, attrName:
+			if c == '=' {
+				state = equal
+			} else if isSpace(c) || c == '/' {
+				state = space
+			}
+
+		case space:
+			if c == '=' {
+				state = equal
+			} else if !isSpace(c) && c != '/' && c != '>' {
+				state = attrName
+				if len(raw)-i >= 2 && strings.EqualFold(raw[i:i+2], "on") {
+					b.WriteString(strings.TrimSuffix(eventAttrPrefix, "on"))
+				}
+			}
+
+		case equal:
+			if c == '"' || c == '\'' {
+				quote = c
+				state = quotedValue
+			} else if !isSpace(c) {
+				state = unquotedValue
+			}
+
+		case quotedValue:
+			if c == quote {
+				state = space
+			}
+
+		case unquotedValue:
+			if isSpace(c) {
+				state = space
+			}
+		}
+
+		b.WriteByte(c)
+		i++
+	}
+	return b.String()
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+// restoreEventAttrs gives back their name to the event handler attributes of
+// the tree t, renamed by escapeEventAttrs.
+func restoreEventAttrs(t *Tag) {
+	for k, v := range t.Attrs {
+		if strings.HasPrefix(k, eventAttrPrefix) {
+			delete(t.Attrs, k)
+			t.Attrs["on"+k[len(eventAttrPrefix):]] = v
+		}
+	}
+
+	for i := range t.Children {
+		restoreEventAttrs(&t.Children[i])
+	}
+}
+
+// bind returns a copy of t with the functions from funcMap bound.
+func (t parsedTemplate) bind(funcMap template.FuncMap) (tmpl parsedTemplate, err error) {
+	tmpl.refs = t.refs
+
+	if t.text != nil {
+		if tmpl.text, err = t.text.Clone(); err != nil {
+			return
+		}
+		tmpl.text.Funcs(funcMap)
+		return
+	}
+
+	if tmpl.html, err = t.html.Clone(); err != nil {
+		return
+	}
+	tmpl.html.Funcs(htmltemplate.FuncMap(funcMap))
+	return
+}
+
+func (t parsedTemplate) Execute(w io.Writer, data interface{}) error {
+	if t.text != nil {
+		return t.text.Execute(w, data)
+	}
+	return t.html.Execute(w, data)
+}
+
+// TemplateError describes an error that occurred while parsing or executing
+// the template of a component.
+type TemplateError struct {
+	// Component is the type of the component.
+	Component string
+
+	// Line and Column locate the error in the template. They start at 1.
+	// Column is 0 when it can't be determined.
+	Line   int
+	Column int
+
+	// Excerpt is the line of the template where the error occurred.
+	Excerpt string
+
+	// Err is the error reported by the template package.
+	Err error
+
+	msg string
+}
+
+var (
+	templateErrorLocation = regexp.MustCompile(`^(?:html/)?template: ?[^:]*:(\d+):(?:(\d+):)? ?(.*)$`)
+	templateErrorToken    = regexp.MustCompile(`"([^"]+)"|'([^']+)'|<([^>]+)>`)
+)
+
+// newTemplateError creates a template error from the error err returned by
+// the template package for the template src of component c.
+func newTemplateError(c Componer, src string, err error) *TemplateError {
+	e := &TemplateError{
+		Component: fmt.Sprintf("%T", c),
+		Err:       err,
+		msg:       err.Error(),
+	}
+
+	m := templateErrorLocation.FindStringSubmatch(err.Error())
+	if m == nil {
+		return e
+	}
+
+	e.Line, _ = strconv.Atoi(m[1])
+	e.msg = m[3]
+
+	// Execution errors report a column that starts at 0.
+	if col, err := strconv.Atoi(m[2]); err == nil {
+		e.Column = col + 1
+	}
+
+	lines := strings.Split(src, "\n")
+	if e.Line < 1 || e.Line > len(lines) {
+		return e
+	}
+	e.Excerpt = strings.TrimSpace(lines[e.Line-1])
+
+	// Parse errors do not report a column. It is deduced from the position of
+	// the token quoted in the message.
+	if e.Column == 0 {
+		if tok := templateErrorToken.FindStringSubmatch(e.msg); tok != nil {
+			token := tok[1] + tok[2] + tok[3]
+			if idx := strings.Index(lines[e.Line-1], token); idx != -1 {
+				e.Column = idx + 1
+			}
+		}
+	}
+	return e
+}
+
+func (e *TemplateError) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("template %s: %s", e.Component, e.msg)
+	}
+
+	loc := fmt.Sprintf("%s:%d", e.Component, e.Line)
+	if e.Column != 0 {
+		loc = fmt.Sprintf("%s:%d", loc, e.Column)
+	}
+
+	if len(e.Excerpt) == 0 {
+		return fmt.Sprintf("template %s: %s", loc, e.msg)
+	}
+	return fmt.Sprintf("template %s: %s: %s", loc, e.msg, e.Excerpt)
+}
+
+// templateCache stores the parsed templates of components by component type.
+// A cached template is only used when the template source and the function
+// names it has been parsed with are the same as the ones of the rendering.
+type templateCache struct {
+	mutex   sync.RWMutex
+	entries map[reflect.Type]templateCacheEntry
+}
+
+type templateCacheEntry struct {
+	src   string
+	funcs map[string]struct{}
+	raw   bool
+	tmpl  parsedTemplate
+}
+
+func (c *templateCache) get(t reflect.Type, src string, funcMap template.FuncMap, raw bool) (tmpl parsedTemplate, ok bool) {
+	c.mutex.RLock()
+	entry, ok := c.entries[t]
+	c.mutex.RUnlock()
+
+	if !ok || entry.src != src || entry.raw != raw || len(entry.funcs) != len(funcMap) {
+		return tmpl, false
+	}
+
+	for name := range funcMap {
+		if _, ok = entry.funcs[name]; !ok {
+			return tmpl, false
+		}
+	}
+	return entry.tmpl, true
+}
+
+func (c *templateCache) set(t reflect.Type, src string, funcMap template.FuncMap, raw bool, tmpl parsedTemplate) {
+	funcs := make(map[string]struct{}, len(funcMap))
+	for name := range funcMap {
+		funcs[name] = struct{}{}
+	}
+
+	c.mutex.Lock()
+	c.entries[t] = templateCacheEntry{
+		src:   src,
+		funcs: funcs,
+		raw:   raw,
+		tmpl:  tmpl,
+	}
+	c.mutex.Unlock()
 }
 
 func convertToJSON(v interface{}) string {
@@ -189,6 +956,11 @@ func convertToJSON(v interface{}) string {
 	return template.HTMLEscapeString(string(b))
 }
 
+func convertToUnescapedJSON(v interface{}) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
 func formatTime(t time.Time, layout string) string {
 	return t.Format(layout)
 }
@@ -197,6 +969,9 @@ func formatTime(t time.Time, layout string) string {
 // jval to the field named n.
 // Methods must take 0 or 1 arg and no return values.
 // Methods and and fields must be exported.
+// jval is decoded as JSON. JSON strings are converted as attributes when the
+// type of the field or of the argument has a registered converter or
+// implements encoding.TextUnmarshaler.
 func CallOrAssign(c Componer, n string, jval string) error {
 	structval := reflect.ValueOf(c)
 
@@ -230,20 +1005,16 @@ func callComponentMethod(m reflect.Value, jval string) error {
 	}
 
 	argt := mtype.In(0)
-	argv := reflect.New(argt)
-	argi := argv.Interface()
+	arg := reflect.New(argt).Elem()
 
-	if err := json.Unmarshal([]byte(jval), argi); err != nil {
+	if err := unmarshalJSON(arg, jval); err != nil {
 		return errors.Wrap(err, "mapping method 1st arg failed")
 	}
 
-	arg := argv.Elem()
 	m.Call([]reflect.Value{arg})
 	return nil
 }
 
 func assignComponentField(f reflect.Value, jval string) error {
-	fv := f.Addr()
-	fi := fv.Interface()
-	return json.Unmarshal([]byte(jval), fi)
+	return unmarshalJSON(f, jval)
 }
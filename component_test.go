@@ -1,8 +1,12 @@
 package markup
 
 import (
+	"reflect"
 	"testing"
+	"text/template"
 	"time"
+
+	"github.com/pkg/errors"
 )
 
 type ValidCompo ZeroCompo
@@ -63,6 +67,195 @@ func (c *CompoWithFields) FuncWithMultipleArg(a, b int) {
 	panic("should not be called")
 }
 
+type CompoWithTags struct {
+	UserID   string `markup:"data-user-id"`
+	Label    string `markup:"aria-label,required"`
+	Hidden   bool   `markup:",omitempty"`
+	Size     int    `markup:",omitempty"`
+	Cache    string `markup:"-"`
+	Disabled bool
+}
+
+func (c *CompoWithTags) Render() string {
+	return `<div aria-label="{{.Label}}">{{.UserID}}</div>`
+}
+
+type CompoWithTagsParent ZeroCompo
+
+func (c *CompoWithTagsParent) Render() string {
+	return `
+<div>
+	<markup.compowithtags data-user-id="42">
+</div>
+	`
+}
+
+type CompoWithDefaults struct {
+	Size  int   `markup:",default=10"`
+	Items []int `markup:",omitempty,default=[1, 2]"`
+	Count int
+}
+
+func (c *CompoWithDefaults) Render() string {
+	return `<p>{{.Size}} {{.Count}}</p>`
+}
+
+func (c *CompoWithDefaults) Validate() error {
+	if c.Count < 0 {
+		return &PropError{
+			Attr:   "count",
+			Reason: "must be positive",
+		}
+	}
+	return nil
+}
+
+type CompoWithDefaultsParent struct {
+	Count int
+}
+
+func (c *CompoWithDefaultsParent) Render() string {
+	return `
+<div>
+	<markup.compowithdefaults count="{{.Count}}">
+</div>
+	`
+}
+
+type CompoWithBadDefault struct {
+	Size int `markup:",default=ten"`
+}
+
+func (c *CompoWithBadDefault) Render() string {
+	return `<p>{{.Size}}</p>`
+}
+
+type BaseProps struct {
+	ID     string
+	Class  string
+	Hidden bool
+}
+
+type StyleProps struct {
+	Style string
+}
+
+type ExtraProps struct {
+	Class string
+}
+
+type CompoWithEmbedded struct {
+	BaseProps
+	*StyleProps
+	Class string
+	Name  string
+}
+
+func (c *CompoWithEmbedded) Render() string {
+	return `<p>{{.Name}}</p>`
+}
+
+type CompoWithConflict struct {
+	BaseProps
+	ExtraProps
+}
+
+func (c *CompoWithConflict) Render() string {
+	return `<p>{{.ID}}</p>`
+}
+
+type CompoWithResolvedConflict struct {
+	BaseProps
+	ExtraProps
+	Class string
+}
+
+func (c *CompoWithResolvedConflict) Render() string {
+	return `<p>{{.Class}}</p>`
+}
+
+type CompoWithNamedEmbedded struct {
+	BaseProps `markup:"base"`
+}
+
+func (c *CompoWithNamedEmbedded) Render() string {
+	return `<p>{{.ID}}</p>`
+}
+
+type CompoWithFuncs struct {
+	Name string
+}
+
+func (c *CompoWithFuncs) Render() string {
+	return `<p>{{greet}}</p>`
+}
+
+func (c *CompoWithFuncs) FuncMaps() template.FuncMap {
+	return template.FuncMap{
+		"greet": func() string {
+			return "Hello " + c.Name
+		},
+	}
+}
+
+type DynamicCompo struct {
+	Tag string
+}
+
+func (c *DynamicCompo) Render() string {
+	return "<" + c.Tag + "></" + c.Tag + ">"
+}
+
+func (c *DynamicCompo) DynamicRender() bool {
+	return true
+}
+
+type CompoParseErr ZeroCompo
+
+func (c *CompoParseErr) Render() string {
+	return `
+<div>
+	<h1>{{.Title}</h1>
+</div>
+	`
+}
+
+type EscapedCompo struct {
+	Text  string
+	Title string
+	URL   string
+	Items []string
+}
+
+func (c *EscapedCompo) Render() string {
+	return `
+<div title="{{.Title}}">
+	<a href="{{.URL}}" items="{{json .Items}}">{{.Text}}</a>
+</div>
+	`
+}
+
+type CompoWithHandler struct {
+	Handler string
+}
+
+func (c *CompoWithHandler) Render() string {
+	return `
+<div onclick="{{.Handler}}" title="{{.Handler}}" data-x="{{.Handler}} one=1" data-y='click on=here' value='online=true'>
+	<input onChange = "OnChange" type="text">
+	<markup.hello onselect="{{.Handler}}">
+</div>
+	`
+}
+
+type RawCompo struct {
+	EscapedCompo
+}
+
+func (c *RawCompo) RawRender() bool {
+	return true
+}
+
 func TestEnsureValidCompo(t *testing.T) {
 	valc := &ValidCompo{}
 	if err := ensureValidComponent(valc); err != nil {
@@ -211,6 +404,434 @@ func testMapComponentFieldsErrors(t *testing.T, attrs AttrMap) {
 	t.Log(err)
 }
 
+func TestMapComponentFieldsTags(t *testing.T) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, c *CompoWithTags)
+	}{
+		{
+			name: "renamed attribute",
+			test: func(t *testing.T, c *CompoWithTags) {
+				attrs := AttrMap{"aria-label": "hello", "data-user-id": "42"}
+				if err := mapComponentFields(c, attrs); err != nil {
+					t.Fatal(err)
+				}
+				if c.UserID != "42" {
+					t.Fatal("c.UserID should be 42:", c.UserID)
+				}
+				if c.Label != "hello" {
+					t.Fatal("c.Label should be hello:", c.Label)
+				}
+			},
+		},
+		{
+			name: "skipped field",
+			test: func(t *testing.T, c *CompoWithTags) {
+				c.Cache = "cached"
+				attrs := AttrMap{"aria-label": "hello", "cache": "boo", "-": "boo"}
+				if err := mapComponentFields(c, attrs); err != nil {
+					t.Fatal(err)
+				}
+				if c.Cache != "cached" {
+					t.Fatal("c.Cache should be cached:", c.Cache)
+				}
+			},
+		},
+		{
+			name: "omitempty",
+			test: func(t *testing.T, c *CompoWithTags) {
+				c.Hidden = true
+				c.Disabled = true
+				c.Size = 10
+				attrs := AttrMap{"aria-label": "hello", "size": ""}
+				if err := mapComponentFields(c, attrs); err != nil {
+					t.Fatal(err)
+				}
+				if !c.Hidden {
+					t.Fatal("c.Hidden should be true")
+				}
+				if c.Disabled {
+					t.Fatal("c.Disabled should be false")
+				}
+				if c.Size != 10 {
+					t.Fatal("c.Size should be 10:", c.Size)
+				}
+			},
+		},
+		{
+			name: "missing required attribute",
+			test: func(t *testing.T, c *CompoWithTags) {
+				err := mapComponentFields(c, AttrMap{"data-user-id": "42"})
+				if err == nil {
+					t.Fatal("err should not be nil")
+				}
+				t.Log(err)
+			},
+		},
+		{
+			name: "mount without required attribute",
+			test: func(t *testing.T, c *CompoWithTags) {
+				b := NewCompoBuilder()
+				b.Register(&CompoWithTags{})
+
+				env := NewEnv(b)
+				_, err := env.Mount(&CompoWithTagsParent{})
+				if err == nil {
+					t.Fatal("err should not be nil")
+				}
+				t.Log(err)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) { test.test(t, &CompoWithTags{}) })
+	}
+}
+
+func TestMapComponentFieldsDefaults(t *testing.T) {
+	tests := []struct {
+		name string
+		test func(t *testing.T)
+	}{
+		{
+			name: "default values",
+			test: func(t *testing.T) {
+				c := &CompoWithDefaults{}
+				if err := mapComponentFields(c, AttrMap{"items": ""}); err != nil {
+					t.Fatal(err)
+				}
+				if c.Size != 10 {
+					t.Fatal("c.Size should be 10:", c.Size)
+				}
+				if !reflect.DeepEqual(c.Items, []int{1, 2}) {
+					t.Fatal("c.Items should be [1 2]:", c.Items)
+				}
+			},
+		},
+		{
+			name: "attribute overrides default value",
+			test: func(t *testing.T) {
+				c := &CompoWithDefaults{}
+				if err := mapComponentFields(c, AttrMap{"size": "42"}); err != nil {
+					t.Fatal(err)
+				}
+				if c.Size != 42 {
+					t.Fatal("c.Size should be 42:", c.Size)
+				}
+			},
+		},
+		{
+			name: "bad default value",
+			test: func(t *testing.T) {
+				err := mapComponentFields(&CompoWithBadDefault{}, nil)
+				if err == nil {
+					t.Fatal("err should not be nil")
+				}
+				t.Log(err)
+			},
+		},
+		{
+			name: "invalid attribute",
+			test: func(t *testing.T) {
+				err := mapComponentFields(&CompoWithDefaults{}, AttrMap{"count": "-1"})
+				if err == nil {
+					t.Fatal("err should not be nil")
+				}
+
+				perr, ok := err.(*PropError)
+				if !ok {
+					t.Fatalf("err should be a *PropError: %T", err)
+				}
+				if perr.Component != "*markup.CompoWithDefaults" {
+					t.Fatal("perr.Component should be *markup.CompoWithDefaults:", perr.Component)
+				}
+				if perr.Value != "-1" {
+					t.Fatal("perr.Value should be -1:", perr.Value)
+				}
+				t.Log(err)
+			},
+		},
+		{
+			name: "invalid attribute on update",
+			test: func(t *testing.T) {
+				b := NewCompoBuilder()
+				b.Register(&CompoWithDefaults{})
+
+				env := NewEnv(b)
+				parent := &CompoWithDefaultsParent{Count: 1}
+				if _, err := env.Mount(parent); err != nil {
+					t.Fatal(err)
+				}
+				defer env.Dismount(parent)
+
+				parent.Count = -1
+				_, err := env.Update(parent)
+				if err == nil {
+					t.Fatal("err should not be nil")
+				}
+				if _, ok := errors.Cause(err).(*PropError); !ok {
+					t.Fatalf("err cause should be a *PropError: %T", errors.Cause(err))
+				}
+				t.Log(err)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, test.test)
+	}
+}
+
+func TestMapComponentFieldsEmbedded(t *testing.T) {
+	tests := []struct {
+		name string
+		test func(t *testing.T)
+	}{
+		{
+			name: "promoted fields",
+			test: func(t *testing.T) {
+				c := &CompoWithEmbedded{}
+				attrs := AttrMap{
+					"id":     "42",
+					"class":  "outer",
+					"hidden": "true",
+					"style":  "color: red",
+					"name":   "Max",
+				}
+				if err := mapComponentFields(c, attrs); err != nil {
+					t.Fatal(err)
+				}
+
+				if c.ID != "42" {
+					t.Fatal("c.ID should be 42:", c.ID)
+				}
+				if !c.Hidden {
+					t.Fatal("c.Hidden should be true")
+				}
+				if c.Class != "outer" {
+					t.Fatal("c.Class should be outer:", c.Class)
+				}
+				if c.BaseProps.Class != "" {
+					t.Fatal("c.BaseProps.Class should be empty:", c.BaseProps.Class)
+				}
+				if c.StyleProps == nil || c.Style != "color: red" {
+					t.Fatalf("c.Style should be color: red: %+v", c.StyleProps)
+				}
+			},
+		},
+		{
+			name: "nil embedded pointer",
+			test: func(t *testing.T) {
+				c := &CompoWithEmbedded{}
+				if err := mapComponentFields(c, AttrMap{"name": "Max"}); err != nil {
+					t.Fatal(err)
+				}
+				if c.StyleProps != nil {
+					t.Fatal("c.StyleProps should be nil")
+				}
+			},
+		},
+		{
+			name: "conflicting fields",
+			test: func(t *testing.T) {
+				err := mapComponentFields(&CompoWithConflict{}, AttrMap{"id": "42"})
+				if err == nil {
+					t.Fatal("err should not be nil")
+				}
+				t.Log(err)
+			},
+		},
+		{
+			name: "resolved conflict",
+			test: func(t *testing.T) {
+				c := &CompoWithResolvedConflict{}
+				if err := mapComponentFields(c, AttrMap{"class": "outer"}); err != nil {
+					t.Fatal(err)
+				}
+				if c.Class != "outer" {
+					t.Fatal("c.Class should be outer:", c.Class)
+				}
+			},
+		},
+		{
+			name: "named embedded struct",
+			test: func(t *testing.T) {
+				c := &CompoWithNamedEmbedded{}
+				if err := mapComponentFields(c, AttrMap{"base": `{"ID": "42"}`, "id": "21"}); err != nil {
+					t.Fatal(err)
+				}
+				if c.ID != "42" {
+					t.Fatal("c.ID should be 42:", c.ID)
+				}
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, test.test)
+	}
+}
+
+func TestComponentTemplateCache(t *testing.T) {
+	c := &ValidCompo{}
+
+	tmpl, err := componentTemplate(c, c.Render())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cached, _ := componentTemplate(c, c.Render()); cached != tmpl {
+		t.Fatal("template should have been cached")
+	}
+
+	var root Tag
+	if err := decodeComponent(&CompoWithFuncs{Name: "Max"}, &root); err != nil {
+		t.Fatal(err)
+	}
+	root = Tag{}
+	if err := decodeComponent(&CompoWithFuncs{Name: "Jonhy"}, &root); err != nil {
+		t.Fatal(err)
+	}
+	if text := root.Children[0].Text; text != "Hello Jonhy" {
+		t.Fatalf(`text should be "Hello Jonhy": "%s"`, text)
+	}
+
+	root = Tag{}
+	if err := decodeComponent(&DynamicCompo{Tag: "h1"}, &root); err != nil {
+		t.Fatal(err)
+	}
+	root = Tag{}
+	if err := decodeComponent(&DynamicCompo{Tag: "h2"}, &root); err != nil {
+		t.Fatal(err)
+	}
+	if root.Name != "h2" {
+		t.Fatalf(`root should be a h2: "%s"`, root.Name)
+	}
+	if _, ok := templates.entries[reflect.TypeOf(&DynamicCompo{})]; ok {
+		t.Fatal("template of a dynamic component should not be cached")
+	}
+}
+
+func TestDecodeComponentTemplateErrors(t *testing.T) {
+	var root Tag
+	err := decodeComponent(&CompoParseErr{}, &root)
+	if err == nil {
+		t.Fatal("err should not be nil")
+	}
+	t.Log(err)
+
+	tmplErr, ok := errors.Cause(err).(*TemplateError)
+	if !ok {
+		t.Fatalf("err cause should be a *TemplateError: %T", errors.Cause(err))
+	}
+	if tmplErr.Component != "*markup.CompoParseErr" {
+		t.Errorf(`tmplErr.Component should be "*markup.CompoParseErr": "%s"`, tmplErr.Component)
+	}
+	if tmplErr.Line != 3 || tmplErr.Column != 14 {
+		t.Errorf("tmplErr should be located at 3:14: %v:%v", tmplErr.Line, tmplErr.Column)
+	}
+	if tmplErr.Excerpt != "<h1>{{.Title}</h1>" {
+		t.Errorf(`tmplErr.Excerpt should be "<h1>{{.Title}</h1>": "%s"`, tmplErr.Excerpt)
+	}
+
+	root = Tag{}
+	if err = decodeComponent(&CompoBadTmpl{}, &root); err == nil {
+		t.Fatal("err should not be nil")
+	}
+	t.Log(err)
+
+	if tmplErr, ok = errors.Cause(err).(*TemplateError); !ok {
+		t.Fatalf("err cause should be a *TemplateError: %T", errors.Cause(err))
+	}
+	if tmplErr.Line != 1 || tmplErr.Column != 7 {
+		t.Errorf("tmplErr should be located at 1:7: %v:%v", tmplErr.Line, tmplErr.Column)
+	}
+}
+
+func TestDecodeComponentEscaping(t *testing.T) {
+	c := &EscapedCompo{
+		Text:  "<script>alert(42)</script>",
+		Title: `hello" onclick="alert(42)`,
+		URL:   "javascript:alert(42)",
+		Items: []string{`"a"`, "<b>"},
+	}
+
+	var root Tag
+	if err := decodeComponent(c, &root); err != nil {
+		t.Fatal(err)
+	}
+
+	if l := len(root.Attrs); l != 1 {
+		t.Fatal("root should have 1 attribute:", l)
+	}
+	if title := root.Attrs["title"]; title != c.Title {
+		t.Errorf(`title should be "%s": "%s"`, c.Title, title)
+	}
+
+	a := root.Children[0]
+	if href := a.Attrs["href"]; href == c.URL {
+		t.Errorf(`href should not be "%s"`, href)
+	}
+	if items := a.Attrs["items"]; items != `["\"a\"","\u003cb\u003e"]` {
+		t.Errorf("items should contain the json of c.Items: %s", items)
+	}
+	if l := len(a.Children); l != 1 {
+		t.Fatal("a should have 1 child:", l)
+	}
+	if text := a.Children[0]; !text.IsText() || text.Text != c.Text {
+		t.Errorf(`a child should be the text "%s": %+v`, c.Text, text)
+	}
+}
+
+func TestDecodeComponentHandler(t *testing.T) {
+	c := &CompoWithHandler{Handler: "OnClick"}
+
+	var root Tag
+	if err := decodeComponent(c, &root); err != nil {
+		t.Fatal(err)
+	}
+
+	if onclick := root.Attrs["onclick"]; onclick != c.Handler {
+		t.Errorf(`onclick should be "%s": "%s"`, c.Handler, onclick)
+	}
+	if l := len(root.Attrs); l != 5 {
+		t.Error("root should have 5 attributes:", l)
+	}
+
+	values := map[string]string{
+		"data-x": c.Handler + " one=1",
+		"data-y": "click on=here",
+		"value":  "online=true",
+	}
+	for k, v := range values {
+		if val := root.Attrs[k]; val != v {
+			t.Errorf(`%s should be "%s": "%s"`, k, v, val)
+		}
+	}
+
+	if onchange := root.Children[0].Attrs["onchange"]; onchange != "OnChange" {
+		t.Errorf(`onchange should be "OnChange": "%s"`, onchange)
+	}
+	if onselect := root.Children[1].Attrs["onselect"]; onselect != c.Handler {
+		t.Errorf(`onselect should be "%s": "%s"`, c.Handler, onselect)
+	}
+}
+
+func TestDecodeRawComponent(t *testing.T) {
+	c := &RawCompo{}
+	c.Text = "<script>alert(42)</script>"
+
+	var root Tag
+	if err := decodeComponent(c, &root); err != nil {
+		t.Fatal(err)
+	}
+
+	a := root.Children[0]
+	if script := a.Children[0]; script.Name != "script" {
+		t.Errorf(`a child should be a script: "%s"`, script.Name)
+	}
+}
+
 func TestConvertToJSON(t *testing.T) {
 	c := &CompoWithFields{}
 	t.Log(convertToJSON(c))
@@ -290,3 +911,29 @@ func TestCallOrAssignErrors(t *testing.T) {
 	}
 	t.Log(err)
 }
+
+func BenchmarkDecodeComponent(b *testing.B) {
+	hello := &Hello{Name: "JonhyMaxoo"}
+
+	for i := 0; i < b.N; i++ {
+		var root Tag
+		decodeComponent(hello, &root)
+	}
+}
+
+func BenchmarkDecodeDynamicComponent(b *testing.B) {
+	hello := &DynamicHello{Hello{Name: "JonhyMaxoo"}}
+
+	for i := 0; i < b.N; i++ {
+		var root Tag
+		decodeComponent(hello, &root)
+	}
+}
+
+type DynamicHello struct {
+	Hello
+}
+
+func (h *DynamicHello) DynamicRender() bool {
+	return true
+}
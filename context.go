@@ -0,0 +1,159 @@
+package markup
+
+import (
+	"reflect"
+	"sync"
+)
+
+// Context is the interface that describes the values shared by a component
+// with the components nested in it.
+//
+// Context methods are safe for concurrent use and can be called from
+// lifecycle hooks.
+type Context interface {
+	// Provide makes v available under key to the components nested in the
+	// component. Keys should be of a type defined by the package that
+	// provides them, like context.Context keys.
+	// Values should be provided in SetContext or Render in order to be
+	// available to the nested components when they are rendered.
+	//
+	// Components that got the previous value under key from the component
+	// are marked as dirty and are updated by the next call to Env.Flush.
+	Provide(key, v interface{})
+
+	// Value returns the value provided under key by the nearest component
+	// the component is nested in, or nil if there is no such value.
+	// The component is marked as dirty when the returned value changes.
+	Value(key interface{}) interface{}
+}
+
+// ContextUser is the interface that wraps SetContext method.
+// SetContext is called before a component is rendered for the first time,
+// with the context that it can use to provide values to its nested
+// components and to get the values provided by the components it is nested
+// in.
+// Components projected into the slots of a component are nested in it.
+type ContextUser interface {
+	SetContext(ctx Context)
+}
+
+// contextStore stores the contexts of the components mounted in an
+// environment.
+// It has its own mutex since contexts are used from lifecycle hooks, while
+// the environment is locked.
+type contextStore struct {
+	mutex sync.Mutex
+
+	// dirty contains the components that use a value that changed and the
+	// components whose methods were called as callbacks.
+	dirty map[Componer]struct{}
+}
+
+// markDirty marks the component c as dirty.
+func (s *contextStore) markDirty(c Componer) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.dirty == nil {
+		s.dirty = make(map[Componer]struct{})
+	}
+	s.dirty[c] = struct{}{}
+}
+
+// takeDirty returns the components that use a value that changed and forgets
+// them.
+func (s *contextStore) takeDirty() map[Componer]struct{} {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	dirty := s.dirty
+	s.dirty = nil
+	return dirty
+}
+
+type componentContext struct {
+	store  *contextStore
+	compo  Componer
+	parent *componentContext
+	values map[interface{}]interface{}
+
+	// users contains, by key, the contexts that got the value provided under
+	// the key.
+	users map[interface{}]map[*componentContext]struct{}
+}
+
+func (c *componentContext) Provide(key, v interface{}) {
+	c.store.mutex.Lock()
+	defer c.store.mutex.Unlock()
+
+	old, ok := c.values[key]
+	if ok && sameValue(old, v) {
+		return
+	}
+
+	if c.values == nil {
+		c.values = make(map[interface{}]interface{})
+	}
+	c.values[key] = v
+
+	if len(c.users[key]) == 0 {
+		return
+	}
+
+	if c.store.dirty == nil {
+		c.store.dirty = make(map[Componer]struct{})
+	}
+	for user := range c.users[key] {
+		c.store.dirty[user.compo] = struct{}{}
+	}
+}
+
+func (c *componentContext) Value(key interface{}) interface{} {
+	c.store.mutex.Lock()
+	defer c.store.mutex.Unlock()
+
+	for p := c.parent; p != nil; p = p.parent {
+		v, ok := p.values[key]
+		if !ok {
+			continue
+		}
+
+		if p.users == nil {
+			p.users = make(map[interface{}]map[*componentContext]struct{})
+		}
+		if p.users[key] == nil {
+			p.users[key] = make(map[*componentContext]struct{})
+		}
+		p.users[key][c] = struct{}{}
+		return v
+	}
+	return nil
+}
+
+// release removes the references to c from the contexts of the components it
+// is nested in.
+func (c *componentContext) release() {
+	c.store.mutex.Lock()
+	defer c.store.mutex.Unlock()
+
+	for p := c.parent; p != nil; p = p.parent {
+		for _, users := range p.users {
+			delete(users, c)
+		}
+	}
+	delete(c.store.dirty, c.compo)
+}
+
+// sameValue reports whether the values a and b are equal. Values that can't
+// be compared, including those of comparable types that hold uncomparable
+// values in interfaces, are not equal.
+func sameValue(a, b interface{}) bool {
+	t := reflect.TypeOf(a)
+	if t != reflect.TypeOf(b) {
+		return false
+	}
+	if t == nil {
+		return true
+	}
+	return reflect.ValueOf(a).Comparable() && reflect.ValueOf(b).Comparable() && a == b
+}
@@ -0,0 +1,195 @@
+package markup
+
+import "testing"
+
+type themeKey struct{}
+
+type ThemeProvider struct {
+	Theme string
+	ctx   Context
+}
+
+func (p *ThemeProvider) SetContext(ctx Context) {
+	p.ctx = ctx
+}
+
+func (p *ThemeProvider) Render() string {
+	p.ctx.Provide(themeKey{}, p.Theme)
+
+	return `
+<div>
+	<markup.themedlabel>
+	<markup.card>
+		<markup.themedlabel>
+	</markup.card>
+	<markup.world name="unthemed">
+</div>
+	`
+}
+
+type ThemedLabel struct {
+	ctx   Context
+	theme string
+}
+
+func (l *ThemedLabel) SetContext(ctx Context) {
+	l.ctx = ctx
+}
+
+func (l *ThemedLabel) Render() string {
+	l.theme, _ = l.ctx.Value(themeKey{}).(string)
+	return `<span>{{.Theme}}</span>`
+}
+
+func (l *ThemedLabel) Theme() string {
+	return l.theme
+}
+
+func TestContext(t *testing.T) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, env *env, p *ThemeProvider)
+	}{
+		{
+			name: "lookup provided value",
+			test: testContextValue,
+		},
+		{
+			name: "update provided value",
+			test: testContextUpdate,
+		},
+		{
+			name: "provide value from outside",
+			test: testContextProvide,
+		},
+		{
+			name: "value without provider",
+			test: testContextNoProvider,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b := NewCompoBuilder()
+			b.Register(&ThemeProvider{})
+			b.Register(&ThemedLabel{})
+			b.Register(&Card{})
+			b.Register(&World{})
+
+			env := newEnv(b)
+			p := &ThemeProvider{Theme: "dark"}
+
+			if _, err := env.Mount(p); err != nil {
+				t.Fatal(err)
+			}
+			defer env.Dismount(p)
+
+			test.test(t, env, p)
+		})
+	}
+}
+
+// themedLabels returns the labels mounted in env.
+func themedLabels(env *env) (labels []*ThemedLabel) {
+	for _, c := range env.components {
+		if l, ok := c.(*ThemedLabel); ok {
+			labels = append(labels, l)
+		}
+	}
+	return
+}
+
+func testContextThemes(t *testing.T, env *env, theme string) {
+	labels := themedLabels(env)
+	if l := len(labels); l != 2 {
+		t.Fatal("env should have 2 labels:", l)
+	}
+
+	for _, l := range labels {
+		if l.theme != theme {
+			t.Fatalf("label theme should be %s: %s", theme, l.theme)
+		}
+	}
+}
+
+func testContextValue(t *testing.T, env *env, p *ThemeProvider) {
+	testContextThemes(t, env, "dark")
+
+	if v := p.ctx.Value(themeKey{}); v != nil {
+		t.Fatal("provider should not get its own value:", v)
+	}
+}
+
+func testContextUpdate(t *testing.T, env *env, p *ThemeProvider) {
+	p.Theme = "light"
+	env.MarkDirty(p)
+
+	syncs, err := env.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := len(syncs); l != 2 {
+		t.Fatal("syncs should have 2 elements:", l)
+	}
+	testContextThemes(t, env, "light")
+
+	env.MarkDirty(p)
+	if syncs, _ = env.Flush(); len(syncs) != 0 {
+		t.Fatal("syncs should be empty:", len(syncs))
+	}
+}
+
+func testContextProvide(t *testing.T, env *env, p *ThemeProvider) {
+	done := make(chan struct{})
+	go func() {
+		p.ctx.Provide(themeKey{}, "blue")
+		close(done)
+	}()
+	<-done
+
+	if _, err := env.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	testContextThemes(t, env, "blue")
+}
+
+func testContextNoProvider(t *testing.T, env *env, p *ThemeProvider) {
+	l := &ThemedLabel{}
+	if _, err := env.Mount(l); err != nil {
+		t.Fatal(err)
+	}
+	defer env.Dismount(l)
+
+	if l.theme != "" {
+		t.Fatal("label theme should be empty:", l.theme)
+	}
+	if l := len(env.contexts); l != 6 {
+		t.Fatal("env should have 6 contexts:", l)
+	}
+}
+
+type SameValueItem struct {
+	Value interface{}
+}
+
+func TestSameValue(t *testing.T) {
+	tests := []struct {
+		a, b interface{}
+		same bool
+	}{
+		{a: 42, b: 42, same: true},
+		{a: 42, b: 21, same: false},
+		{a: 42, b: "42", same: false},
+		{a: nil, b: nil, same: true},
+		{a: []int{1}, b: []int{1}, same: false},
+		{a: SameValueItem{Value: 1}, b: SameValueItem{Value: 1}, same: true},
+		{a: SameValueItem{Value: 1}, b: SameValueItem{Value: []int{1}}, same: false},
+		{a: SameValueItem{Value: []int{1}}, b: SameValueItem{Value: []int{1}}, same: false},
+	}
+
+	for _, test := range tests {
+		if same := sameValue(test.a, test.b); same != test.same {
+			t.Errorf("sameValue(%v, %v) should be %v", test.a, test.b, test.same)
+		}
+	}
+}
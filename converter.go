@@ -0,0 +1,130 @@
+package markup
+
+import (
+	"encoding"
+	"encoding/json"
+	"net/url"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Converter is a function that converts the string s to a value of the type
+// it is registered for.
+type Converter func(s string) (v interface{}, err error)
+
+// RegisterConverter registers conv as the converter of the values of type t.
+//
+// Converters are used when attributes are mapped to component fields and when
+// CallOrAssign gets a JSON string for a field or a method argument of type t,
+// or of type pointer to t.
+// They take precedence over encoding.TextUnmarshaler. Values returned by conv
+// must be assignable to t.
+//
+// Converters for time.Duration, which parses durations like "1h30m", and
+// url.URL are registered by default.
+func RegisterConverter(t reflect.Type, conv Converter) {
+	converters.set(t, conv)
+}
+
+var converters = converterRegistry{
+	convs: map[reflect.Type]Converter{
+		reflect.TypeOf(time.Duration(0)): convertDuration,
+		reflect.TypeOf(url.URL{}):        convertURL,
+	},
+}
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// converterRegistry stores the converters by type.
+type converterRegistry struct {
+	mutex sync.RWMutex
+	convs map[reflect.Type]Converter
+}
+
+func (r *converterRegistry) get(t reflect.Type) (conv Converter, ok bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	conv, ok = r.convs[t]
+	return
+}
+
+func (r *converterRegistry) set(t reflect.Type, conv Converter) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.convs[t] = conv
+}
+
+// convertString sets the addressable value v to the conversion of s.
+// ok is false if there is no converter registered for the type of v and if v
+// does not implement encoding.TextUnmarshaler.
+// Pointers are allocated if the type they point to is convertible.
+func convertString(v reflect.Value, s string) (ok bool, err error) {
+	t := v.Type()
+
+	if conv, ok := converters.get(t); ok {
+		return true, convertValue(v, conv, s)
+	}
+
+	if reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		return true, v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+	}
+
+	if t.Kind() != reflect.Ptr {
+		return false, nil
+	}
+
+	ptr := reflect.New(t.Elem())
+	if ok, err = convertString(ptr.Elem(), s); !ok || err != nil {
+		return
+	}
+	v.Set(ptr)
+	return
+}
+
+func convertValue(v reflect.Value, conv Converter, s string) error {
+	cv, err := conv(s)
+	if err != nil {
+		return err
+	}
+
+	rv := reflect.ValueOf(cv)
+	if !rv.IsValid() {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+
+	if !rv.Type().AssignableTo(v.Type()) {
+		return errors.Errorf("converter for %v returned a %T", v.Type(), cv)
+	}
+	v.Set(rv)
+	return nil
+}
+
+// unmarshalJSON sets the addressable value v to the JSON value jval.
+// JSON strings are converted with convertString when possible.
+func unmarshalJSON(v reflect.Value, jval string) error {
+	var s string
+	if err := json.Unmarshal([]byte(jval), &s); err == nil {
+		if ok, err := convertString(v, s); ok {
+			return err
+		}
+	}
+	return json.Unmarshal([]byte(jval), v.Addr().Interface())
+}
+
+func convertDuration(s string) (interface{}, error) {
+	return time.ParseDuration(s)
+}
+
+func convertURL(s string) (interface{}, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	return *u, nil
+}
@@ -0,0 +1,160 @@
+package markup
+
+import (
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type Color int
+
+func (c *Color) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "red":
+		*c = 1
+	case "blue":
+		*c = 2
+	default:
+		return errors.Errorf("unknown color %s", text)
+	}
+	return nil
+}
+
+type Level string
+
+type BadLevel string
+
+func init() {
+	RegisterConverter(reflect.TypeOf(Level("")), func(s string) (interface{}, error) {
+		return Level(strings.ToUpper(s)), nil
+	})
+
+	RegisterConverter(reflect.TypeOf(BadLevel("")), func(s string) (interface{}, error) {
+		return s, nil
+	})
+}
+
+type CompoWithConverters struct {
+	Timeout  time.Duration
+	Start    time.Time
+	Link     url.URL
+	LinkPtr  *url.URL
+	Color    Color
+	Level    Level
+	BadLevel BadLevel
+
+	waited time.Duration
+}
+
+func (c *CompoWithConverters) Render() string {
+	return `<p>{{.Timeout}}</p>`
+}
+
+func (c *CompoWithConverters) Wait(d time.Duration) {
+	c.waited = d
+}
+
+func TestMapComponentFieldsConverters(t *testing.T) {
+	c := &CompoWithConverters{}
+	attrs := AttrMap{
+		"timeout": "1m30s",
+		"start":   "2017-06-02T10:00:00Z",
+		"link":    "https://murlok.io/users?id=42",
+		"linkptr": "/users",
+		"color":   "blue",
+		"level":   "debug",
+	}
+
+	if err := mapComponentFields(c, attrs); err != nil {
+		t.Fatal(err)
+	}
+
+	if c.Timeout != 90*time.Second {
+		t.Fatal("c.Timeout should be 1m30s:", c.Timeout)
+	}
+	if start := time.Date(2017, 6, 2, 10, 0, 0, 0, time.UTC); !c.Start.Equal(start) {
+		t.Fatal("c.Start should be", start, ":", c.Start)
+	}
+	if c.Link.Host != "murlok.io" || c.Link.Query().Get("id") != "42" {
+		t.Fatal("c.Link should be https://murlok.io/users?id=42:", c.Link.String())
+	}
+	if c.LinkPtr == nil || c.LinkPtr.Path != "/users" {
+		t.Fatal("c.LinkPtr should be /users:", c.LinkPtr)
+	}
+	if c.Color != 2 {
+		t.Fatal("c.Color should be 2:", c.Color)
+	}
+	if c.Level != "DEBUG" {
+		t.Fatal("c.Level should be DEBUG:", c.Level)
+	}
+}
+
+func TestMapComponentFieldsConvertersErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		attrs AttrMap
+	}{
+		{
+			name:  "converter error",
+			attrs: AttrMap{"timeout": "forever"},
+		},
+		{
+			name:  "text unmarshaler error",
+			attrs: AttrMap{"color": "green"},
+		},
+		{
+			name:  "converter returning a bad type",
+			attrs: AttrMap{"badlevel": "debug"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := mapComponentFields(&CompoWithConverters{}, test.attrs)
+			if err == nil {
+				t.Fatal("err should not be nil")
+			}
+			t.Log(err)
+		})
+	}
+}
+
+func TestCallOrAssignConverters(t *testing.T) {
+	c := &CompoWithConverters{}
+
+	if err := CallOrAssign(c, "Timeout", `"2s"`); err != nil {
+		t.Fatal(err)
+	}
+	if c.Timeout != 2*time.Second {
+		t.Fatal("c.Timeout should be 2s:", c.Timeout)
+	}
+
+	if err := CallOrAssign(c, "Timeout", `1000`); err != nil {
+		t.Fatal(err)
+	}
+	if c.Timeout != time.Microsecond {
+		t.Fatal("c.Timeout should be 1µs:", c.Timeout)
+	}
+
+	if err := CallOrAssign(c, "Color", `"red"`); err != nil {
+		t.Fatal(err)
+	}
+	if c.Color != 1 {
+		t.Fatal("c.Color should be 1:", c.Color)
+	}
+
+	if err := CallOrAssign(c, "Wait", `"1h"`); err != nil {
+		t.Fatal(err)
+	}
+	if c.waited != time.Hour {
+		t.Fatal("c.waited should be 1h:", c.waited)
+	}
+
+	if err := CallOrAssign(c, "Wait", `"soon"`); err == nil {
+		t.Fatal("err should not be nil")
+	}
+}
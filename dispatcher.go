@@ -0,0 +1,52 @@
+package markup
+
+import "sync"
+
+// dispatcher executes functions one at a time, in the order they have been
+// dispatched.
+// Functions are executed on a goroutine that is started when a function is
+// dispatched and that exits once there is no more function to execute.
+type dispatcher struct {
+	mutex   sync.Mutex
+	queue   []func()
+	running bool
+}
+
+// Dispatch queues f to be executed on the dispatcher goroutine.
+func (d *dispatcher) Dispatch(f func()) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.queue = append(d.queue, f)
+
+	if !d.running {
+		d.running = true
+		go d.run()
+	}
+}
+
+func (d *dispatcher) run() {
+	for {
+		f, ok := d.next()
+		if !ok {
+			return
+		}
+		f()
+	}
+}
+
+func (d *dispatcher) next() (f func(), ok bool) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if len(d.queue) == 0 {
+		d.running = false
+		return
+	}
+
+	f = d.queue[0]
+	d.queue[0] = nil
+	d.queue = d.queue[1:]
+	ok = true
+	return
+}
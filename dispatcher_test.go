@@ -0,0 +1,49 @@
+package markup
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestDispatcherOrder(t *testing.T) {
+	var d dispatcher
+	var wg sync.WaitGroup
+	var order []int
+
+	wg.Add(100)
+
+	for i := 0; i < 100; i++ {
+		n := i
+		d.Dispatch(func() {
+			order = append(order, n)
+			wg.Done()
+		})
+	}
+	wg.Wait()
+
+	for i, n := range order {
+		if n != i {
+			t.Fatalf("function %v should have been executed at position %v: %v", n, i, n)
+		}
+	}
+}
+
+func TestDispatcherConcurrent(t *testing.T) {
+	var d dispatcher
+	var wg sync.WaitGroup
+	count := 0
+
+	wg.Add(100)
+
+	for i := 0; i < 100; i++ {
+		go d.Dispatch(func() {
+			count++
+			wg.Done()
+		})
+	}
+	wg.Wait()
+
+	if count != 100 {
+		t.Fatal("count should be 100:", count)
+	}
+}
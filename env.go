@@ -1,12 +1,23 @@
 package markup
 
 import (
+	"sort"
+	"sync"
+
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
 )
 
 // Env is the interface that describes an environment that handles components
 // lifecycle.
+//
+// Env methods are safe for concurrent use but components are not: code that
+// modifies components, like CallOrAssign, should be executed with Dispatch
+// along with the Update it triggers.
+// Tags returned by an Env share memory with its mounted trees and should also
+// be read from dispatched functions when components are updated concurrently.
+// Component lifecycle hooks are called while the environment is locked. They
+// must not call Env methods directly and should use Dispatch instead.
 type Env interface {
 	// Component returns the component mounted under the identifier id.
 	// err should be set if there is no mounted component under id.
@@ -27,28 +38,157 @@ type Env interface {
 
 	// Dismount removes references to a component and its children.
 	Dismount(c Componer)
+
+	// Update renders the component c again and synchronizes its mounted tree
+	// with the result.
+	// It returns the operations to apply to a rendered version of c in order
+	// to reflect the modifications.
+	//
+	// Nested components whose attributes changed get their fields mapped and
+	// are updated as part of c. Nested components whose attributes did not
+	// change are not rendered again.
+	// Lifecycle hooks are called in this order for each nested component:
+	// OnPropsChange, ShouldUpdate, then OnUpdate once it is synchronized.
+	// OnUpdate is called on c after being called on its nested components.
+	// Nested components that are added or removed are mounted or dismounted.
+	//
+	// If an error occurs, syncs is nil and c stays mounted. Root then returns
+	// the tree of c in a partially synchronized state: modifications made
+	// before the error are kept, tags that failed to be replaced are mounted
+	// again from their previous description and the tree only refers to
+	// mounted components. A tag that fails to be mounted again is replaced by
+	// an element without children. Renderers should discard the rendered
+	// version of c and rebuild it from its root.
+	// When c is nested in an error boundary, the error is handled by the
+	// nearest one as during its own update and syncs describes its fallback.
+	Update(c Componer) (syncs []Sync, err error)
+
+	// MarkDirty marks the component c as needing to be updated by the next
+	// call to Flush.
+	MarkDirty(c Componer)
+
+	// Flush updates the components marked as dirty and returns the operations
+	// that reflect their modifications in a single batch.
+	// Components that use a context value that changed are also updated,
+	// including values provided by the components rendered during the flush,
+	// as well as the components whose methods were called as callbacks.
+	// Components are updated from the top of the tree to the bottom and each
+	// of them is rendered at most once: a dirty component updated as part of
+	// its parent is not rendered again.
+	// Operations that target tags rebuilt by another operation of the batch
+	// are removed.
+	//
+	// If an error occurs, the components that were not updated stay dirty.
+	// syncs then contains the operations of the components updated before
+	// the error, followed by the one that rebuilds the component that failed
+	// from its root, which is left as described by Update.
+	Flush() (syncs []Sync, err error)
+
+	// Dispatch queues f to be executed on the environment dispatch loop.
+	// It does not wait for f to be executed.
+	// Dispatched functions are executed one at a time, in the order they have
+	// been dispatched.
+	Dispatch(f func())
 }
 
 // NewEnv creates an environment.
-func NewEnv(b CompoBuilder) Env {
-	return newEnv(b)
+func NewEnv(b CompoBuilder, opts ...EnvOption) Env {
+	return newEnv(b, opts...)
 }
 
-func newEnv(b CompoBuilder) *env {
-	return &env{
+func newEnv(b CompoBuilder, opts ...EnvOption) *env {
+	e := &env{
 		components:   make(map[uuid.UUID]Componer),
 		compoRoots:   make(map[Componer]Tag),
+		parents:      make(map[uuid.UUID]uuid.UUID),
+		projections:  make(map[uuid.UUID]projection),
+		contexts:     make(map[uuid.UUID]*componentContext),
+		dirty:        make(map[Componer]struct{}),
 		compoBuilder: b,
 	}
+
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
 }
 
+// EnvOption represents an option used to configure an environment.
+type EnvOption func(e *env)
+
+// WithSyncMode returns an option that sets the way an environment describes
+// the modifications of its components.
+func WithSyncMode(m SyncMode) EnvOption {
+	return func(e *env) {
+		e.syncMode = m
+	}
+}
+
+// SyncMode represents the way an environment describes the modifications of
+// its components.
+type SyncMode int
+
+// Constants that define the sync modes.
+const (
+	// FullSyncMode describes modifications with SyncTag operations that
+	// either update the attributes of a tag or rebuild it entirely.
+	FullSyncMode SyncMode = iota
+
+	// PatchSyncMode describes modifications with granular operations that set
+	// or remove attributes, set texts and insert, move, remove or replace
+	// children.
+	PatchSyncMode
+)
+
 type env struct {
+	mutex        sync.Mutex
+	dispatcher   dispatcher
 	components   map[uuid.UUID]Componer
 	compoRoots   map[Componer]Tag
+	parents      map[uuid.UUID]uuid.UUID
+	projections  map[uuid.UUID]projection
+	contexts     map[uuid.UUID]*componentContext
+	contextStore contextStore
+	dirty        map[Componer]struct{}
 	compoBuilder CompoBuilder
+	syncMode     SyncMode
+
+	// rendering contains the ids of the components being mounted or updated.
+	// The last one is the component that the mounted components are nested
+	// in.
+	rendering []uuid.UUID
+}
+
+// projection describes the children of a component tag, projected into the
+// slots of the component.
+type projection struct {
+	// owner is the id of the component that rendered the component tag.
+	// Projected tags are mounted as tags of the owner.
+	owner    uuid.UUID
+	children []Tag
+}
+
+// slotChildren returns a copy of the projected children that go into the slot
+// named name. Children go into the slot named by their slot attribute or into
+// the slot without name when they do not have one.
+func (p projection) slotChildren(name string) []Tag {
+	var children []Tag
+	for _, child := range p.children {
+		if child.Attrs["slot"] == name {
+			children = append(children, copyTag(child))
+		}
+	}
+	return children
 }
 
 func (e *env) Component(id uuid.UUID) (c Componer, err error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	return e.component(id)
+}
+
+func (e *env) component(id uuid.UUID) (c Componer, err error) {
 	ok := false
 	if c, ok = e.components[id]; !ok {
 		err = errors.Errorf("no component with id %v is mounted", id)
@@ -57,6 +197,9 @@ func (e *env) Component(id uuid.UUID) (c Componer, err error) {
 }
 
 func (e *env) Root(c Componer) (root Tag, err error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
 	ok := false
 	if root, ok = e.compoRoots[c]; !ok {
 		err = errors.Errorf("%T is not mounted", c)
@@ -65,6 +208,9 @@ func (e *env) Root(c Componer) (root Tag, err error) {
 }
 
 func (e *env) Mount(c Componer) (root Tag, err error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
 	rootID := uuid.New()
 	compoID := uuid.New()
 	return e.mount(c, rootID, compoID)
@@ -76,14 +222,44 @@ func (e *env) mount(c Componer, rootID uuid.UUID, compoID uuid.UUID) (root Tag,
 		return
 	}
 
+	ctx := e.newContext(c, compoID)
+	defer func() {
+		if err != nil {
+			ctx.release()
+			delete(e.contexts, compoID)
+		}
+	}()
+
+	e.rendering = append(e.rendering, compoID)
+	defer e.popRendering()
+
 	if err = decodeComponent(c, &root); err != nil {
 		err = errors.Wrapf(err, "fail to mount %T", c)
 		return
 	}
+	e.fillSlots(&root, compoID)
 
 	if err = e.mountTag(&root, rootID, compoID); err != nil {
 		err = errors.Wrapf(err, "fail to mount %T", c)
-		return
+
+		boundary, ok := c.(ErrorBoundary)
+		if !ok {
+			return
+		}
+
+		boundary.OnError(err)
+
+		root = Tag{}
+		if err = decodeComponent(c, &root); err != nil {
+			err = errors.Wrapf(err, "fail to mount %T fallback", c)
+			return
+		}
+		e.fillSlots(&root, compoID)
+
+		if err = e.mountTag(&root, rootID, compoID); err != nil {
+			err = errors.Wrapf(err, "fail to mount %T fallback", c)
+			return
+		}
 	}
 
 	e.components[compoID] = c
@@ -95,6 +271,29 @@ func (e *env) mount(c Componer, rootID uuid.UUID, compoID uuid.UUID) (root Tag,
 	return
 }
 
+// newContext creates the context of the component c, identified by compoID,
+// and passes it to c if it implements ContextUser.
+// c is nested in the component being rendered.
+func (e *env) newContext(c Componer, compoID uuid.UUID) *componentContext {
+	ctx := &componentContext{
+		store: &e.contextStore,
+		compo: c,
+	}
+	if n := len(e.rendering); n != 0 {
+		ctx.parent = e.contexts[e.rendering[n-1]]
+	}
+	e.contexts[compoID] = ctx
+
+	if user, ok := c.(ContextUser); ok {
+		user.SetContext(ctx)
+	}
+	return ctx
+}
+
+func (e *env) popRendering() {
+	e.rendering = e.rendering[:len(e.rendering)-1]
+}
+
 func (e *env) mountTag(t *Tag, id uuid.UUID, compoID uuid.UUID) error {
 	t.ID = id
 	t.CompoID = compoID
@@ -108,20 +307,32 @@ func (e *env) mountTag(t *Tag, id uuid.UUID, compoID uuid.UUID) error {
 		if err != nil {
 			return errors.Wrapf(err, "fail to mount %s", t.Name)
 		}
-		if err = mapComponentFields(c, t.Attrs); err != nil {
+		if err = mapComponentProps(c, t.Attrs, t.values, &e.contextStore); err != nil {
 			return errors.Wrapf(err, "fail to mount %s", t.Name)
 		}
 
+		e.projections[id] = projection{
+			owner:    compoID,
+			children: t.Children,
+		}
+
 		rootID := uuid.New()
 		if _, err = e.mount(c, rootID, id); err != nil {
+			delete(e.projections, id)
 			return errors.Wrapf(err, "fail to mount %s", t.Name)
 		}
+		e.parents[id] = compoID
 		return nil
 	}
 
+	childCompoID := e.childCompoID(t)
+
 	for i := range t.Children {
 		childID := uuid.New()
-		if err := e.mountTag(&t.Children[i], childID, compoID); err != nil {
+		if err := e.mountTag(&t.Children[i], childID, childCompoID); err != nil {
+			for _, child := range t.Children[:i] {
+				e.dismountTag(child)
+			}
 			return errors.Wrapf(err, "fail to mount %s child", t.Name)
 		}
 	}
@@ -129,6 +340,13 @@ func (e *env) mountTag(t *Tag, id uuid.UUID, compoID uuid.UUID) error {
 }
 
 func (e *env) Dismount(c Componer) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.dismount(c)
+}
+
+func (e *env) dismount(c Componer) {
 	root, ok := e.compoRoots[c]
 	if !ok {
 		return
@@ -137,6 +355,14 @@ func (e *env) Dismount(c Componer) {
 	e.dismountTag(root)
 	delete(e.components, root.CompoID)
 	delete(e.compoRoots, c)
+	delete(e.parents, root.CompoID)
+	delete(e.projections, root.CompoID)
+	delete(e.dirty, c)
+
+	if ctx, ok := e.contexts[root.CompoID]; ok {
+		ctx.release()
+		delete(e.contexts, root.CompoID)
+	}
 
 	if dismounter, ok := c.(Dismounter); ok {
 		dismounter.OnDismount()
@@ -144,14 +370,39 @@ func (e *env) Dismount(c Componer) {
 	return
 }
 
+// dismountAll dismounts the components that are not nested in another
+// component, which dismounts every mounted component.
+func (e *env) dismountAll() {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	var roots []Componer
+	for id, c := range e.components {
+		if _, nested := e.parents[id]; !nested {
+			roots = append(roots, c)
+		}
+	}
+
+	for _, c := range roots {
+		e.dismount(c)
+	}
+}
+
+func (e *env) componentCount() int {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	return len(e.components)
+}
+
 func (e *env) dismountTag(t Tag) {
 	if t.IsComponent() {
-		c, err := e.Component(t.ID)
+		c, err := e.component(t.ID)
 		if err != nil {
 			return
 		}
 
-		e.Dismount(c)
+		e.dismount(c)
 		return
 	}
 
@@ -162,24 +413,295 @@ func (e *env) dismountTag(t Tag) {
 }
 
 func (e *env) Update(c Componer) (syncs []Sync, err error) {
-	syncs, _, err = e.update(c)
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if syncs, err = e.updateRoot(c); err != nil {
+		syncs = nil
+	}
+	return
+}
+
+func (e *env) MarkDirty(c Componer) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if _, ok := e.compoRoots[c]; ok {
+		e.dirty[c] = struct{}{}
+	}
+}
+
+func (e *env) Flush() (syncs []Sync, err error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.markContextDirty()
+
+	// Components can provide new values when they are rendered, which marks
+	// the components that use them as dirty. Dirty components are updated
+	// until there are no more.
+	for len(e.dirty) != 0 {
+		for _, c := range e.sortedDirty() {
+			// c is no longer dirty when it has been updated or dismounted as
+			// part of a previously updated component.
+			if _, ok := e.dirty[c]; !ok {
+				continue
+			}
+
+			var compoSyncs []Sync
+			if compoSyncs, err = e.updateRoot(c); err != nil {
+				// The tree of c is partially synchronized. It is rebuilt from
+				// its root.
+				syncs = append(syncs, e.rebuildSync(c))
+				syncs = e.dedupSyncs(syncs)
+				return
+			}
+			syncs = append(syncs, compoSyncs...)
+
+			e.markContextDirty()
+		}
+	}
+
+	syncs = e.dedupSyncs(syncs)
 	return
 }
 
+// rebuildSync returns the operation that rebuilds the tree of the mounted
+// component c from its root.
+func (e *env) rebuildSync(c Componer) Sync {
+	root := e.compoRoots[c]
+
+	if e.syncMode == PatchSyncMode {
+		return Sync{
+			Op:  SyncReplace,
+			Tag: root,
+			ID:  root.ID,
+		}
+	}
+
+	return Sync{
+		Tag:  root,
+		Full: true,
+	}
+}
+
+// markContextDirty marks as dirty the mounted components that use a context
+// value that changed.
+func (e *env) markContextDirty() {
+	for c := range e.contextStore.takeDirty() {
+		if _, ok := e.compoRoots[c]; ok {
+			e.dirty[c] = struct{}{}
+		}
+	}
+}
+
+// sortedDirty returns the dirty components, sorted from the less nested to
+// the most nested.
+func (e *env) sortedDirty() []Componer {
+	dirty := make([]Componer, 0, len(e.dirty))
+	depths := make(map[Componer]int, len(e.dirty))
+
+	for c := range e.dirty {
+		dirty = append(dirty, c)
+		depths[c] = e.depth(c)
+	}
+
+	sort.SliceStable(dirty, func(i, j int) bool {
+		return depths[dirty[i]] < depths[dirty[j]]
+	})
+	return dirty
+}
+
+func (e *env) Dispatch(f func()) {
+	e.dispatcher.Dispatch(f)
+}
+
+// depth returns the number of components that contain the component c.
+func (e *env) depth(c Componer) int {
+	depth := 0
+	id := e.compoRoots[c].CompoID
+
+	for {
+		parentID, ok := e.parents[id]
+		if !ok {
+			return depth
+		}
+		id = parentID
+		depth++
+	}
+}
+
+// dedupSyncs removes the operations that target tags rebuilt by another
+// operation.
+func (e *env) dedupSyncs(syncs []Sync) []Sync {
+	rebuilt := make(map[uuid.UUID]int)
+
+	for i, s := range syncs {
+		if (s.Op == SyncTag && s.Full) || s.Op == SyncInsert || s.Op == SyncReplace {
+			e.indexRebuiltTags(rebuilt, s.Tag, i)
+		}
+	}
+
+	dedup := syncs[:0]
+	for i, s := range syncs {
+		if j, ok := rebuilt[syncTarget(s)]; ok && j != i {
+			continue
+		}
+		dedup = append(dedup, s)
+	}
+	return dedup
+}
+
+func (e *env) indexRebuiltTags(rebuilt map[uuid.UUID]int, t Tag, syncIndex int) {
+	if _, ok := rebuilt[t.ID]; !ok {
+		rebuilt[t.ID] = syncIndex
+	}
+
+	if t.IsComponent() {
+		c, err := e.component(t.ID)
+		if err != nil {
+			return
+		}
+		e.indexRebuiltTags(rebuilt, e.compoRoots[c], syncIndex)
+		return
+	}
+
+	for _, child := range t.Children {
+		e.indexRebuiltTags(rebuilt, child, syncIndex)
+	}
+}
+
+// syncTarget returns the id of the tag that is modified by the operation s.
+func syncTarget(s Sync) uuid.UUID {
+	switch s.Op {
+	case SyncTag:
+		return s.Tag.ID
+
+	case SyncSetAttr, SyncRemoveAttr:
+		return s.ID
+
+	case SyncReplace:
+		if s.ParentID == uuid.Nil {
+			return s.ID
+		}
+	}
+	return s.ParentID
+}
+
+// updateRoot updates the component c and returns the operations that reflect
+// its modifications, including those of its root.
+func (e *env) updateRoot(c Componer) (syncs []Sync, err error) {
+	var syncParent bool
+	syncs, syncParent, err = e.update(c)
+
+	// An error is handled by the nearest error boundary that contains c.
+	// When its fallback fails too, the error goes to the next one.
+	for err != nil {
+		var boundary ErrorBoundary
+		if c, boundary = e.parentBoundary(c); boundary == nil {
+			return
+		}
+		syncs, syncParent, err = e.updateFallback(c, boundary, err)
+	}
+
+	if syncParent && e.syncMode == PatchSyncMode {
+		root := e.compoRoots[c]
+		syncs = append(syncs, Sync{
+			Op:  SyncReplace,
+			Tag: root,
+			ID:  root.ID,
+		})
+	}
+	return
+}
+
+// parentBoundary returns the nearest error boundary that contains the
+// component c.
+func (e *env) parentBoundary(c Componer) (Componer, ErrorBoundary) {
+	id := e.compoRoots[c].CompoID
+
+	for {
+		parentID, ok := e.parents[id]
+		if !ok {
+			return nil, nil
+		}
+
+		parent := e.components[parentID]
+		if boundary, ok := parent.(ErrorBoundary); ok {
+			return parent, boundary
+		}
+		id = parentID
+	}
+}
+
 func (e *env) update(c Componer) (syncs []Sync, syncParent bool, err error) {
 	root, ok := e.compoRoots[c]
 	if !ok {
 		err = errors.Errorf("%T is not mounted", c)
 		return
 	}
+	delete(e.dirty, c)
+
+	e.rendering = append(e.rendering, root.CompoID)
+	defer e.popRendering()
 
 	var newRoot Tag
 	if err = decodeComponent(c, &newRoot); err != nil {
 		err = errors.Wrapf(err, "fail to update %T", c)
 		return
 	}
+	e.fillSlots(&newRoot, root.CompoID)
+
+	syncs, syncParent, err = e.syncTags(&root, &newRoot)
+	e.compoRoots[c] = root
+
+	if boundary, ok := c.(ErrorBoundary); ok && err != nil {
+		syncs, syncParent, err = e.updateFallback(c, boundary, errors.Wrapf(err, "fail to update %T", c))
+	}
+
+	if updater, ok := c.(Updater); ok && err == nil {
+		updater.OnUpdate()
+	}
+	return
+}
+
+// updateFallback reports the error err, that occurred while updating the
+// nested components of the error boundary c, and updates c in order to render
+// its fallback.
+// The tree of c is partially synchronized when err occurs: it is described as
+// entirely rebuilt.
+func (e *env) updateFallback(c Componer, boundary ErrorBoundary, err error) (syncs []Sync, syncParent bool, fallbackErr error) {
+	boundary.OnError(err)
+
+	root := e.compoRoots[c]
+
+	var newRoot Tag
+	if fallbackErr = decodeComponent(c, &newRoot); fallbackErr != nil {
+		fallbackErr = errors.Wrapf(fallbackErr, "fail to update %T fallback", c)
+		return
+	}
+	e.fillSlots(&newRoot, root.CompoID)
+
+	_, _, fallbackErr = e.syncTags(&root, &newRoot)
+	e.compoRoots[c] = root
 
-	return e.syncTags(&root, &newRoot)
+	if fallbackErr != nil {
+		fallbackErr = errors.Wrapf(fallbackErr, "fail to update %T fallback", c)
+		return
+	}
+
+	if root.IsText() || e.syncMode == PatchSyncMode {
+		syncParent = true
+		return
+	}
+
+	syncs = []Sync{
+		{
+			Tag:  root,
+			Full: true,
+		},
+	}
+	return
 }
 
 func (e *env) syncTags(l, r *Tag) (syncs []Sync, syncParent bool, err error) {
@@ -207,6 +729,11 @@ func (e *env) syncTags(l, r *Tag) (syncs []Sync, syncParent bool, err error) {
 		syncs = append(syncs, subsyncs...)
 	}
 
+	if e.syncMode == PatchSyncMode {
+		syncs = append(syncs, patchAttrs(l, r.Attrs)...)
+		return
+	}
+
 	if attrEq := AttrEquals(l.Attrs, r.Attrs); !attrEq || fullsync {
 		if !attrEq {
 			l.Attrs = r.Attrs
@@ -225,12 +752,17 @@ func (e *env) mergeTags(l, r *Tag) (syncs []Sync, syncParent bool, err error) {
 	e.dismountTag(*l)
 	if err = e.mountTag(r, l.ID, l.CompoID); err != nil {
 		err = errors.Wrapf(err, "fail to merge %s and %s", l.Name, r.Name)
+
+		// l is mounted again to keep the tree consistent.
+		if restoreErr := e.restoreTag(l); restoreErr != nil {
+			err = errors.Wrapf(err, "%s", restoreErr)
+		}
 		return
 	}
 
 	*l = *r
 
-	if l.IsText() {
+	if l.IsText() || e.syncMode == PatchSyncMode {
 		syncParent = true
 		return
 	}
@@ -243,6 +775,32 @@ func (e *env) mergeTags(l, r *Tag) (syncs []Sync, syncParent bool, err error) {
 	return
 }
 
+// restoreTag mounts the tag t again after it failed to be replaced.
+// If t fails to be mounted, it is replaced by an element without children in
+// order to keep the tree referring only to mounted components.
+func (e *env) restoreTag(t *Tag) error {
+	err := e.mountTag(t, t.ID, t.CompoID)
+	if err == nil {
+		return nil
+	}
+
+	restored := Tag{
+		ID:      t.ID,
+		CompoID: t.CompoID,
+		Name:    t.Name,
+		Svg:     t.Svg,
+		Attrs:   t.Attrs,
+	}
+	if t.IsComponent() {
+		restored.Name = "div"
+		restored.Attrs = nil
+	}
+
+	name := t.Name
+	*t = restored
+	return errors.Wrapf(err, "fail to restore %s", name)
+}
+
 func (e *env) syncTextTags(l, r *Tag) (syncParent bool) {
 	if l.Text != r.Text {
 		l.Text = r.Text
@@ -252,19 +810,42 @@ func (e *env) syncTextTags(l, r *Tag) (syncParent bool) {
 }
 
 func (e *env) syncComponentTags(l, r *Tag) (syncs []Sync, syncParent bool, err error) {
-	if AttrEquals(l.Attrs, r.Attrs) {
+	attrsEq := AttrEquals(l.Attrs, r.Attrs) && valuesEqual(l.values, r.values)
+	childrenEq := tagsEqual(l.Children, r.Children)
+
+	if attrsEq && childrenEq {
 		return
 	}
 
+	oldAttrs := l.Attrs
 	l.Attrs = r.Attrs
+	l.values = r.values
+	l.Children = r.Children
 
-	c, err := e.Component(l.ID)
+	c, err := e.component(l.ID)
 	if err != nil {
 		err = errors.Wrapf(err, "fail to sync %s", l.Name)
 		return
 	}
-	if err = mapComponentFields(c, l.Attrs); err != nil {
-		err = errors.Wrapf(err, "fail to sync %s", l.Name)
+
+	if !childrenEq {
+		p := e.projections[l.ID]
+		p.children = r.Children
+		e.projections[l.ID] = p
+	}
+
+	if !attrsEq {
+		if err = mapComponentProps(c, l.Attrs, l.values, &e.contextStore); err != nil {
+			err = errors.Wrapf(err, "fail to sync %s", l.Name)
+			return
+		}
+
+		if observer, ok := c.(PropsObserver); ok {
+			observer.OnPropsChange(oldAttrs, l.Attrs)
+		}
+	}
+
+	if decider, ok := c.(UpdateDecider); ok && childrenEq && !decider.ShouldUpdate(oldAttrs, l.Attrs) {
 		return
 	}
 
@@ -275,6 +856,10 @@ func (e *env) syncComponentTags(l, r *Tag) (syncs []Sync, syncParent bool, err e
 }
 
 func (e *env) syncTagChildren(l, r *Tag) (syncs []Sync, fullsync bool, err error) {
+	if e.syncMode == PatchSyncMode || hasKeyedChildren(l) || hasKeyedChildren(r) {
+		return e.syncKeyedTagChildren(l, r)
+	}
+
 	lc := l.Children
 	rc := r.Children
 	count := 0
@@ -315,7 +900,7 @@ func (e *env) syncTagChildren(l, r *Tag) (syncs []Sync, fullsync bool, err error
 		child := &rc[0]
 		childID := uuid.New()
 
-		if err = e.mountTag(child, childID, l.CompoID); err != nil {
+		if err = e.mountTag(child, childID, e.childCompoID(l)); err != nil {
 			return
 		}
 		l.Children = append(l.Children, *child)
@@ -325,8 +910,395 @@ func (e *env) syncTagChildren(l, r *Tag) (syncs []Sync, fullsync bool, err error
 	return
 }
 
+// syncKeyedTagChildren synchronizes the children of l with the children of r
+// when some of them are identified by a key attribute.
+// Children with the same key are matched regardless of their position and
+// children without key are matched in the order they appear.
+// Children that does not have a match are removed or inserted and matched
+// children that changed position are moved.
+func (e *env) syncKeyedTagChildren(l, r *Tag) (syncs []Sync, fullsync bool, err error) {
+	keyed := make(map[string]int, len(l.Children))
+	var unkeyed []int
+
+	for i, child := range l.Children {
+		key, ok := child.Attrs["key"]
+		if !ok {
+			unkeyed = append(unkeyed, i)
+			continue
+		}
+		if _, dup := keyed[key]; !dup {
+			keyed[key] = i
+		}
+	}
+
+	// matches[i] is the index in l.Children of the child that matches
+	// r.Children[i], or -1 if there is no match.
+	matches := make([]int, len(r.Children))
+	matched := make([]bool, len(l.Children))
+
+	for i, child := range r.Children {
+		matches[i] = -1
+
+		if key, ok := child.Attrs["key"]; ok {
+			if j, ok := keyed[key]; ok && !matched[j] {
+				matches[i] = j
+				matched[j] = true
+			}
+			continue
+		}
+
+		if len(unkeyed) != 0 {
+			matches[i] = unkeyed[0]
+			matched[unkeyed[0]] = true
+			unkeyed = unkeyed[1:]
+		}
+	}
+
+	// current mirrors the position of the l children as the sync operations
+	// are applied.
+	current := make([]int, 0, len(l.Children))
+
+	for i := len(l.Children) - 1; i >= 0; i-- {
+		if matched[i] {
+			continue
+		}
+
+		child := l.Children[i]
+		e.dismountTag(child)
+		syncs = append(syncs, Sync{
+			Op:       SyncRemove,
+			Tag:      child,
+			ParentID: l.ID,
+			Index:    i,
+		})
+	}
+
+	for i := range l.Children {
+		if matched[i] {
+			current = append(current, i)
+		}
+	}
+
+	children := make([]Tag, len(r.Children))
+	var childSyncs []Sync
+
+	for i, j := range matches {
+		if j == -1 {
+			child := &r.Children[i]
+			childID := uuid.New()
+
+			if err = e.mountTag(child, childID, e.childCompoID(l)); err != nil {
+				l.Children = mountedChildren(l.Children, children[:i], matches[i+1:])
+				return
+			}
+			children[i] = *child
+
+			current = append(current, -1)
+			copy(current[i+1:], current[i:])
+			current[i] = -1
+
+			syncs = append(syncs, Sync{
+				Op:       SyncInsert,
+				Tag:      *child,
+				ParentID: l.ID,
+				Index:    i,
+			})
+			continue
+		}
+
+		pos := indexOf(current, j)
+		if pos != i {
+			copy(current[i+1:pos+1], current[i:pos])
+			current[i] = j
+
+			syncs = append(syncs, Sync{
+				Op:       SyncMove,
+				Tag:      l.Children[j],
+				ParentID: l.ID,
+				Index:    i,
+				OldIndex: pos,
+			})
+		}
+
+		child := l.Children[j]
+		wasText := child.IsText()
+
+		var subsyncs []Sync
+		var sp bool
+
+		if subsyncs, sp, err = e.syncTags(&child, &r.Children[i]); err != nil {
+			children[i] = child
+			l.Children = mountedChildren(l.Children, children[:i+1], matches[i+1:])
+			return
+		}
+		childSyncs = append(childSyncs, subsyncs...)
+		children[i] = child
+
+		if !sp {
+			continue
+		}
+
+		if e.syncMode != PatchSyncMode {
+			fullsync = true
+			continue
+		}
+
+		if wasText && child.IsText() {
+			childSyncs = append(childSyncs, Sync{
+				Op:       SyncSetText,
+				ID:       child.ID,
+				ParentID: l.ID,
+				Index:    i,
+				Value:    child.Text,
+			})
+			continue
+		}
+
+		childSyncs = append(childSyncs, Sync{
+			Op:       SyncReplace,
+			Tag:      child,
+			ID:       child.ID,
+			ParentID: l.ID,
+			Index:    i,
+		})
+	}
+
+	l.Children = children
+
+	if fullsync {
+		syncs = nil
+		return
+	}
+
+	syncs = append(syncs, childSyncs...)
+	return
+}
+
+// mountedChildren returns the children that are still mounted when the
+// synchronization of keyed children is interrupted: the synced children
+// followed by the old children matched by the remaining ones.
+func mountedChildren(old []Tag, synced []Tag, remaining []int) []Tag {
+	children := make([]Tag, 0, len(synced)+len(remaining))
+	children = append(children, synced...)
+
+	for _, j := range remaining {
+		if j != -1 {
+			children = append(children, old[j])
+		}
+	}
+	return children
+}
+
+// fillSlots sets the children of the slot tags in t, a tag rendered by the
+// component identified by compoID, to the tags projected into the component.
+// Slots in the children of component tags are also filled in order to
+// forward the projected tags and to detect their modifications.
+func (e *env) fillSlots(t *Tag, compoID uuid.UUID) {
+	if !isSlot(t) {
+		for i := range t.Children {
+			e.fillSlots(&t.Children[i], compoID)
+		}
+		return
+	}
+
+	// Projected tags can contain slots from their owner.
+	p := e.projections[compoID]
+	t.Children = p.slotChildren(t.Attrs["name"])
+
+	for i := range t.Children {
+		e.fillSlots(&t.Children[i], p.owner)
+	}
+}
+
+// childCompoID returns the id of the component that owns the children of t.
+// It is the component that rendered t, except for slots whose children are
+// owned by the component that rendered the projected tags.
+func (e *env) childCompoID(t *Tag) uuid.UUID {
+	if !isSlot(t) {
+		return t.CompoID
+	}
+
+	if p, ok := e.projections[t.CompoID]; ok {
+		return p.owner
+	}
+	return t.CompoID
+}
+
+func isSlot(t *Tag) bool {
+	return t.Name == "slot" && !t.Svg
+}
+
+// copyTag returns a deep copy of t.
+func copyTag(t Tag) Tag {
+	if len(t.Attrs) != 0 {
+		attrs := make(AttrMap, len(t.Attrs))
+		for k, v := range t.Attrs {
+			attrs[k] = v
+		}
+		t.Attrs = attrs
+	}
+
+	if len(t.values) != 0 {
+		values := make(map[string]interface{}, len(t.values))
+		for k, v := range t.values {
+			values[k] = v
+		}
+		t.values = values
+	}
+
+	if len(t.Children) != 0 {
+		children := make([]Tag, len(t.Children))
+		for i, child := range t.Children {
+			children[i] = copyTag(child)
+		}
+		t.Children = children
+	}
+	return t
+}
+
+// tagsEqual reports whether the tags l and r describe the same tree,
+// regardless of their ids.
+func tagsEqual(l, r []Tag) bool {
+	if len(l) != len(r) {
+		return false
+	}
+
+	for i := range l {
+		if l[i].Name != r[i].Name || l[i].Text != r[i].Text || l[i].Svg != r[i].Svg {
+			return false
+		}
+		if !AttrEquals(l[i].Attrs, r[i].Attrs) || !valuesEqual(l[i].values, r[i].values) {
+			return false
+		}
+		if !tagsEqual(l[i].Children, r[i].Children) {
+			return false
+		}
+	}
+	return true
+}
+
+// patchAttrs sets the attributes of t to attrs and returns the operations
+// that describe the modification.
+func patchAttrs(t *Tag, attrs AttrMap) (syncs []Sync) {
+	keys := make([]string, 0, len(t.Attrs)+len(attrs))
+	for k := range t.Attrs {
+		keys = append(keys, k)
+	}
+	for k := range attrs {
+		if _, ok := t.Attrs[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		v, ok := attrs[k]
+		if !ok {
+			syncs = append(syncs, Sync{
+				Op:      SyncRemoveAttr,
+				ID:      t.ID,
+				CompoID: t.CompoID,
+				Attr:    k,
+			})
+			continue
+		}
+
+		if old, ok := t.Attrs[k]; ok && old == v {
+			continue
+		}
+
+		syncs = append(syncs, Sync{
+			Op:      SyncSetAttr,
+			ID:      t.ID,
+			CompoID: t.CompoID,
+			Attr:    k,
+			Value:   v,
+		})
+	}
+
+	t.Attrs = attrs
+	return
+}
+
+func hasKeyedChildren(t *Tag) bool {
+	for _, child := range t.Children {
+		if _, ok := child.Attrs["key"]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func indexOf(s []int, v int) int {
+	for i, val := range s {
+		if val == v {
+			return i
+		}
+	}
+	return -1
+}
+
+// SyncOp represents the kind of a sync operation.
+type SyncOp int
+
+// Constants that define the kinds of sync operation.
+const (
+	// SyncTag is the operation that synchronizes Tag.
+	// If Full is set, the whole tag must be rebuilt. Otherwise, only its
+	// attributes have to be updated.
+	SyncTag SyncOp = iota
+
+	// SyncInsert is the operation that inserts Tag as a child of the tag
+	// identified by ParentID, at position Index.
+	SyncInsert
+
+	// SyncMove is the operation that moves the child at position OldIndex of
+	// the tag identified by ParentID to position Index.
+	// Tag is the moved child.
+	SyncMove
+
+	// SyncRemove is the operation that removes the child at position Index of
+	// the tag identified by ParentID.
+	// Tag is the removed child.
+	SyncRemove
+
+	// SyncSetAttr is the operation that sets the attribute Attr to Value on
+	// the tag identified by ID.
+	SyncSetAttr
+
+	// SyncRemoveAttr is the operation that removes the attribute Attr from the
+	// tag identified by ID.
+	SyncRemoveAttr
+
+	// SyncSetText is the operation that sets the text of the child at position
+	// Index of the tag identified by ParentID to Value.
+	SyncSetText
+
+	// SyncReplace is the operation that replaces a tag by Tag.
+	// The replaced tag is the child at position Index of the tag identified by
+	// ParentID. If ParentID is not set, it is the tag identified by ID.
+	SyncReplace
+)
+
 // Sync represents a sync operatrion.
+// Operations must be applied in the order they are returned, positions being
+// relative to the state left by the previous operations.
+//
+// SyncTag is the only operation produced in FullSyncMode, along with
+// SyncInsert, SyncMove and SyncRemove for keyed children.
+// All the operations but SyncTag are produced in PatchSyncMode.
+//
+// CompoID is the id of the component that contains the tag targeted by
+// SyncSetAttr and SyncRemoveAttr. It allows to bind event handlers.
 type Sync struct {
-	Tag  Tag
-	Full bool
+	Op       SyncOp
+	Tag      Tag
+	Full     bool
+	ID       uuid.UUID
+	CompoID  uuid.UUID
+	ParentID uuid.UUID
+	Index    int
+	OldIndex int
+	Attr     string
+	Value    string
 }
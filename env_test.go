@@ -1,7 +1,9 @@
 package markup
 
 import (
+	"reflect"
 	"strconv"
+	"sync"
 	"testing"
 	"text/template"
 
@@ -67,6 +69,35 @@ func (c *CompoBadChild) Render() string {
 	`
 }
 
+// restorableFails makes Restorable fail to render.
+var restorableFails bool
+
+type Restorable ZeroCompo
+
+func (r *Restorable) Render() string {
+	return `<p>{{if .Fails}}{{.Unknown}}{{end}}</p>`
+}
+
+func (r *Restorable) Fails() bool {
+	return restorableFails
+}
+
+type RestorablePage struct {
+	Swap bool
+}
+
+func (p *RestorablePage) Render() string {
+	return `
+<div>
+	{{if .Swap}}
+		<markup.compobadtmpl>
+	{{else}}
+		<markup.restorable>
+	{{end}}
+</div>
+	`
+}
+
 type CompoBadAttrs ZeroCompo
 
 func (c *CompoBadAttrs) Render() string {
@@ -132,11 +163,80 @@ func (w *World) Render() string {
 	`
 }
 
+type KeyedList struct {
+	Items []string
+	Compo bool
+}
+
+func (l *KeyedList) Render() string {
+	return `
+<ul>
+	{{range .Items}}
+		{{if $.Compo}}
+			<markup.world key="{{.}}" name="{{.}}">
+		{{else}}
+			<li key="{{.}}">{{.}}</li>
+		{{end}}
+	{{end}}
+</ul>
+	`
+}
+
+type ParentCounter struct {
+	Value int
+	Text  string
+}
+
+func (c *ParentCounter) Render() string {
+	return `
+<div>
+	{{.Text}}
+	<p>{{.Value}}</p>
+	<markup.childcounter value="{{.Value}}">
+</div>
+	`
+}
+
+type ChildCounter struct {
+	Value   int
+	Extra   string
+	renders int
+}
+
+func (c *ChildCounter) Render() string {
+	c.renders++
+	return `<span>{{.Value}} {{.Extra}}</span>`
+}
+
 func TestNewEnv(t *testing.T) {
 	b := NewCompoBuilder()
 	NewEnv(b)
 }
 
+func TestEnvUpdate(t *testing.T) {
+	b := NewCompoBuilder()
+	b.Register(&Hello{})
+	b.Register(&World{})
+
+	env := NewEnv(b)
+	hello := &Hello{}
+
+	if _, err := env.Mount(hello); err != nil {
+		t.Fatal(err)
+	}
+	defer env.Dismount(hello)
+
+	hello.Greeting = "Hi"
+
+	syncs, err := env.Update(hello)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := len(syncs); l != 1 {
+		t.Fatal("syncs should have 1 element:", l)
+	}
+}
+
 func TestEnvComponent(t *testing.T) {
 	compoID := uuid.New()
 	foo := &Foo{}
@@ -191,8 +291,10 @@ func TestEnv(t *testing.T) {
 	b.Register(&Bar{})
 	b.Register(&CompoBadTmpl{})
 	b.Register(&CompoBadTag{})
+	b.Register(&CompoParseErr{})
 	b.Register(&CompoNotRegistered{})
 	b.Register(&CompoBadChild{})
+	b.Register(&Restorable{})
 	b.Register(&Hello{})
 	b.Register(&World{})
 
@@ -214,6 +316,10 @@ func TestEnv(t *testing.T) {
 			name: "mount component with bad template",
 			test: func(t *testing.T) { testMountInvalid(t, env, &CompoBadTmpl{}) },
 		},
+		{
+			name: "mount component with template parse error",
+			test: func(t *testing.T) { testMountInvalid(t, env, &CompoParseErr{}) },
+		},
 		{
 			name: "mount component with bad tag",
 			test: func(t *testing.T) { testMountInvalid(t, env, &CompoBadTag{}) },
@@ -290,6 +396,14 @@ func TestEnv(t *testing.T) {
 			name: "update should error when merge with component field error",
 			test: func(t *testing.T) { testEnvUpdateCompoFieldErr(t, env, &Hello{Name: "Maxoo"}) },
 		},
+		{
+			name: "update with error should leave a consistent tree",
+			test: func(t *testing.T) { testEnvUpdateErrConsistentTree(t, env, &Hello{}) },
+		},
+		{
+			name: "update with error should leave a consistent tree when restore fails",
+			test: func(t *testing.T) { testEnvUpdateErrRestoreErr(t, env, &RestorablePage{}) },
+		},
 		{
 			name: "update a component with dismounted child should error",
 			test: func(t *testing.T) { testEnvUpdateSyncNotMountedComponent(t, env, &Hello{Name: "Maxoo"}) },
@@ -652,6 +766,65 @@ func testEnvUpdateCompoFieldErr(t *testing.T, env *env, c *Hello) {
 	t.Log(err)
 }
 
+func testEnvUpdateErrConsistentTree(t *testing.T, env *env, c *Hello) {
+	if _, err := env.Mount(c); err != nil {
+		t.Fatal(err)
+	}
+	defer env.Dismount(c)
+
+	compoCount := len(env.components)
+
+	c.Name = "Maxence"
+	c.ChildErr = true
+
+	syncs, err := env.Update(c)
+	if err == nil {
+		t.Fatal("err should not be nil")
+	}
+	if syncs != nil {
+		t.Fatal("syncs should be nil")
+	}
+
+	root, err := env.Root(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if span := root.Children[2].Children[0]; span.Name != "span" {
+		t.Fatal("span should have been mounted again:", span.Name)
+	}
+	if count := len(env.components); count != compoCount {
+		t.Fatalf("env should have %v components: %v", compoCount, count)
+	}
+}
+
+func testEnvUpdateErrRestoreErr(t *testing.T, env *env, c *RestorablePage) {
+	if _, err := env.Mount(c); err != nil {
+		t.Fatal(err)
+	}
+	defer env.Dismount(c)
+
+	restorableFails = true
+	defer func() { restorableFails = false }()
+
+	c.Swap = true
+
+	_, err := env.Update(c)
+	if err == nil {
+		t.Fatal("err should not be nil")
+	}
+	t.Log(err)
+
+	root, _ := env.Root(c)
+	if placeholder := root.Children[0]; placeholder.Name != "div" || len(placeholder.Children) != 0 {
+		t.Fatalf("restorable should have been replaced by an empty div: %+v", placeholder)
+	}
+	for _, compo := range env.components {
+		if _, ok := compo.(*Restorable); ok {
+			t.Fatal("restorable should not be mounted")
+		}
+	}
+}
+
 func testEnvUpdateSyncNotMountedComponent(t *testing.T, env *env, c *Hello) {
 	root, err := env.Mount(c)
 	if err != nil {
@@ -669,48 +842,1159 @@ func testEnvUpdateSyncNotMountedComponent(t *testing.T, env *env, c *Hello) {
 	t.Log(err)
 }
 
-func BenchmarkMount(b *testing.B) {
-	bui := NewCompoBuilder()
-	bui.Register(&Hello{})
-	bui.Register(&World{})
+func TestEnvConcurrent(t *testing.T) {
+	b := NewCompoBuilder()
+	b.Register(&Foo{})
+	b.Register(&Bar{})
+	b.Register(&Hello{})
+	b.Register(&World{})
 
-	env := newEnv(bui)
+	env := NewEnv(b)
 
-	for i := 0; i < b.N; i++ {
-		hello := &Hello{
-			Name: "JonhyMaxoo",
-		}
-		env.Mount(hello)
-		env.Dismount(hello)
+	hello := &Hello{}
+	if _, err := env.Mount(hello); err != nil {
+		t.Fatal(err)
+	}
+	defer env.Dismount(hello)
+
+	var wg sync.WaitGroup
+	wg.Add(100)
+
+	for i := 0; i < 50; i++ {
+		n := i
+
+		go env.Dispatch(func() {
+			defer wg.Done()
+
+			hello.Greeting = strconv.Itoa(n)
+			if err := CallOrAssign(hello, "Name", `"Max"`); err != nil {
+				t.Error(err)
+			}
+			if _, err := env.Update(hello); err != nil {
+				t.Error(err)
+			}
+		})
+
+		go func() {
+			defer wg.Done()
+
+			foo := &Foo{}
+			if _, err := env.Mount(foo); err != nil {
+				t.Error(err)
+			}
+			env.Dismount(foo)
+		}()
+	}
+	wg.Wait()
+
+	if greeting := hello.Greeting; len(greeting) == 0 {
+		t.Fatal("greeting should have been set")
 	}
 }
 
-func BenchmarkSync(b *testing.B) {
-	bui := NewCompoBuilder()
-	bui.Register(&Hello{})
-	bui.Register(&World{})
+func TestEnvFlush(t *testing.T) {
+	b := NewCompoBuilder()
+	b.Register(&ParentCounter{})
+	b.Register(&ChildCounter{})
+	b.Register(&Hello{})
+	b.Register(&World{})
 
-	env := newEnv(bui)
+	env := newEnv(b)
 
-	hello := &Hello{
-		Name: "JonhyMaxoo",
+	tests := []struct {
+		name string
+		test func(t *testing.T)
+	}{
+		{
+			name: "flush without dirty components",
+			test: func(t *testing.T) { testEnvFlushEmpty(t, env) },
+		},
+		{
+			name: "flush should render components once",
+			test: func(t *testing.T) { testEnvFlushRenderOnce(t, env, &ParentCounter{Text: "hello"}) },
+		},
+		{
+			name: "flush should remove syncs of rebuilt tags",
+			test: func(t *testing.T) { testEnvFlushDedup(t, env, &ParentCounter{Text: "hello"}) },
+		},
+		{
+			name: "flush should ignore dismounted components",
+			test: func(t *testing.T) { testEnvFlushDismounted(t, env, &ParentCounter{Text: "hello"}) },
+		},
+		{
+			name: "flush with error should return the syncs of updated components",
+			test: func(t *testing.T) { testEnvFlushErr(t, env, &Hello{Name: "Max"}) },
+		},
 	}
-	env.Mount(hello)
 
-	alt := false
+	for _, test := range tests {
+		t.Run(test.name, test.test)
+	}
+}
 
-	for i := 0; i < b.N; i++ {
-		if alt {
-			hello.Greeting = "Jon"
-		} else {
-			hello.Greeting = ""
+func testEnvFlushEmpty(t *testing.T, env *env) {
+	syncs, err := env.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := len(syncs); l != 0 {
+		t.Fatal("syncs should be empty:", l)
+	}
+}
+
+func testEnvFlushRenderOnce(t *testing.T, env *env, c *ParentCounter) {
+	root, err := env.Mount(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.Dismount(c)
+
+	compo, err := env.Component(root.Children[2].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	child := compo.(*ChildCounter)
+
+	c.Value = 42
+	child.Extra = "world"
+	env.MarkDirty(child)
+	env.MarkDirty(c)
+
+	syncs, err := env.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := len(syncs); l != 2 {
+		t.Fatal("syncs should have 2 elements:", l)
+	}
+	if child.renders != 2 {
+		t.Fatal("child should have been rendered 2 times:", child.renders)
+	}
+	if l := len(env.dirty); l != 0 {
+		t.Fatal("env should not have dirty components:", l)
+	}
+}
+
+func testEnvFlushDedup(t *testing.T, env *env, c *ParentCounter) {
+	root, err := env.Mount(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.Dismount(c)
+
+	compo, err := env.Component(root.Children[2].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	child := compo.(*ChildCounter)
+
+	c.Text = "bye"
+	child.Extra = "world"
+	env.MarkDirty(c)
+	env.MarkDirty(child)
+
+	syncs, err := env.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := len(syncs); l != 1 {
+		t.Fatal("syncs should have 1 element:", l)
+	}
+
+	s := syncs[0]
+	if !s.Full || s.Tag.ID != root.ID {
+		t.Fatal("s should be a full synchronization of the root")
+	}
+}
+
+func testEnvFlushDismounted(t *testing.T, env *env, c *ParentCounter) {
+	if _, err := env.Mount(c); err != nil {
+		t.Fatal(err)
+	}
+
+	env.MarkDirty(c)
+	env.Dismount(c)
+
+	syncs, err := env.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := len(syncs); l != 0 {
+		t.Fatal("syncs should be empty:", l)
+	}
+}
+
+func testEnvFlushErr(t *testing.T, env *env, c *Hello) {
+	if _, err := env.Mount(c); err != nil {
+		t.Fatal(err)
+	}
+	defer env.Dismount(c)
+
+	var world *World
+	for _, compo := range env.components {
+		if w, ok := compo.(*World); ok {
+			world = w
 		}
-		hello.TextBye = alt
-		hello.Placeholder = strconv.Itoa(i)
-		hello.Greeting = strconv.Itoa(i)
+	}
 
-		env.Update(hello)
+	c.Greeting = "Hi"
+	env.MarkDirty(c)
 
-		alt = !alt
+	world.Err = true
+	env.MarkDirty(world)
+
+	syncs, err := env.Flush()
+	if err == nil {
+		t.Fatal("err should not be nil")
+	}
+	if l := len(syncs); l != 2 {
+		t.Fatal("syncs should have 2 elements:", l)
+	}
+
+	if h1 := syncs[0].Tag; h1.Name != "h1" {
+		t.Error("first sync should target h1:", h1.Name)
 	}
+
+	worldRoot, _ := env.Root(world)
+	if s := syncs[1]; s.Tag.ID != worldRoot.ID || !s.Full {
+		t.Errorf("last sync should rebuild the world root: %+v", s)
+	}
+}
+
+func TestEnvKeyed(t *testing.T) {
+	b := NewCompoBuilder()
+	b.Register(&KeyedList{})
+	b.Register(&World{})
+
+	env := newEnv(b)
+
+	tests := []struct {
+		name string
+		test func(t *testing.T)
+	}{
+		{
+			name: "insert keyed child",
+			test: func(t *testing.T) { testEnvKeyedInsert(t, env, &KeyedList{Items: []string{"b", "c"}}) },
+		},
+		{
+			name: "remove keyed child",
+			test: func(t *testing.T) { testEnvKeyedRemove(t, env, &KeyedList{Items: []string{"a", "b", "c"}}) },
+		},
+		{
+			name: "move keyed child",
+			test: func(t *testing.T) { testEnvKeyedMove(t, env, &KeyedList{Items: []string{"a", "b", "c"}}) },
+		},
+		{
+			name: "move keyed component",
+			test: func(t *testing.T) {
+				testEnvKeyedMoveComponent(t, env, &KeyedList{Items: []string{"a", "b"}, Compo: true})
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, test.test)
+	}
+}
+
+func testEnvKeyedInsert(t *testing.T, env *env, c *KeyedList) {
+	root, err := env.Mount(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.Dismount(c)
+
+	bID := root.Children[0].ID
+	c.Items = []string{"a", "b", "c"}
+
+	syncs, err := env.Update(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := len(syncs); l != 1 {
+		t.Fatal("syncs should have 1 element:", l)
+	}
+
+	s := syncs[0]
+	if s.Op != SyncInsert {
+		t.Fatal("s should be an insert:", s.Op)
+	}
+	if s.Full {
+		t.Fatal("s should not be a full synchronization")
+	}
+	if s.ParentID != root.ID {
+		t.Fatal("s.ParentID should be the root id")
+	}
+	if s.Index != 0 {
+		t.Fatal("s.Index should be 0:", s.Index)
+	}
+	if key := s.Tag.Attrs["key"]; key != "a" {
+		t.Fatalf(`inserted tag key should be "a": "%s"`, key)
+	}
+
+	root, _ = env.Root(c)
+	if l := len(root.Children); l != 3 {
+		t.Fatal("root should have 3 children:", l)
+	}
+	if id := root.Children[1].ID; id != bID {
+		t.Fatal("b should have kept its id")
+	}
+}
+
+func testEnvKeyedRemove(t *testing.T, env *env, c *KeyedList) {
+	root, err := env.Mount(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.Dismount(c)
+
+	cID := root.Children[2].ID
+	c.Items = []string{"a", "c"}
+
+	syncs, err := env.Update(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := len(syncs); l != 1 {
+		t.Fatal("syncs should have 1 element:", l)
+	}
+
+	s := syncs[0]
+	if s.Op != SyncRemove {
+		t.Fatal("s should be a remove:", s.Op)
+	}
+	if s.Index != 1 {
+		t.Fatal("s.Index should be 1:", s.Index)
+	}
+
+	root, _ = env.Root(c)
+	if l := len(root.Children); l != 2 {
+		t.Fatal("root should have 2 children:", l)
+	}
+	if id := root.Children[1].ID; id != cID {
+		t.Fatal("c should have kept its id")
+	}
+}
+
+func testEnvKeyedMove(t *testing.T, env *env, c *KeyedList) {
+	root, err := env.Mount(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.Dismount(c)
+
+	cID := root.Children[2].ID
+	c.Items = []string{"c", "a", "b"}
+
+	syncs, err := env.Update(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := len(syncs); l != 1 {
+		t.Fatal("syncs should have 1 element:", l)
+	}
+
+	s := syncs[0]
+	if s.Op != SyncMove {
+		t.Fatal("s should be a move:", s.Op)
+	}
+	if s.OldIndex != 2 || s.Index != 0 {
+		t.Fatalf("s should move child from 2 to 0: %v to %v", s.OldIndex, s.Index)
+	}
+
+	root, _ = env.Root(c)
+	if id := root.Children[0].ID; id != cID {
+		t.Fatal("c should have kept its id")
+	}
+}
+
+func testEnvKeyedMoveComponent(t *testing.T, env *env, c *KeyedList) {
+	root, err := env.Mount(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.Dismount(c)
+
+	b, err := env.Component(root.Children[1].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Items = []string{"b", "a"}
+
+	syncs, err := env.Update(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := len(syncs); l != 1 {
+		t.Fatal("syncs should have 1 element:", l)
+	}
+	if s := syncs[0]; s.Op != SyncMove {
+		t.Fatal("s should be a move:", s.Op)
+	}
+
+	root, _ = env.Root(c)
+	moved, err := env.Component(root.Children[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moved != b {
+		t.Fatal("b component should have been preserved")
+	}
+	if count := len(env.components); count != 3 {
+		t.Fatal("env should have 3 components:", count)
+	}
+}
+
+func TestEnvPatch(t *testing.T) {
+	b := NewCompoBuilder()
+	b.Register(&Hello{})
+	b.Register(&World{})
+
+	env := newEnv(b, WithSyncMode(PatchSyncMode))
+
+	tests := []struct {
+		name string
+		test func(t *testing.T)
+	}{
+		{
+			name: "update should not do modifications",
+			test: func(t *testing.T) { testEnvNoUpdate(t, env, &Hello{}) },
+		},
+		{
+			name: "update should set text",
+			test: func(t *testing.T) { testEnvPatchText(t, env, &Hello{Greeting: "Hi"}) },
+		},
+		{
+			name: "update should set attribute",
+			test: func(t *testing.T) { testEnvPatchAttr(t, env, &Hello{}) },
+		},
+		{
+			name: "update should replace html tag by component",
+			test: func(t *testing.T) { testEnvPatchReplace(t, env, &Hello{}) },
+		},
+		{
+			name: "update should replace and remove children",
+			test: func(t *testing.T) { testEnvPatchChildren(t, env, &Hello{}) },
+		},
+		{
+			name: "update should patch component",
+			test: func(t *testing.T) { testEnvPatchComponent(t, env, &Hello{Name: "Jonhy"}) },
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, test.test)
+	}
+}
+
+func testEnvPatchText(t *testing.T, env *env, c *Hello) {
+	root, err := env.Mount(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.Dismount(c)
+
+	c.Greeting = "Hello"
+
+	syncs, err := env.Update(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := len(syncs); l != 1 {
+		t.Fatal("syncs should have 1 element:", l)
+	}
+
+	s := syncs[0]
+	if s.Op != SyncSetText {
+		t.Fatal("s should set a text:", s.Op)
+	}
+	if s.ParentID != root.Children[0].ID {
+		t.Fatal("s.ParentID should be the h1 id")
+	}
+	if s.Index != 0 {
+		t.Fatal("s.Index should be 0:", s.Index)
+	}
+	if s.Value != c.Greeting {
+		t.Fatalf(`s.Value should be "%s": "%s"`, c.Greeting, s.Value)
+	}
+}
+
+func testEnvPatchAttr(t *testing.T, env *env, c *Hello) {
+	root, err := env.Mount(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.Dismount(c)
+
+	c.Placeholder = "Enter your name"
+
+	syncs, err := env.Update(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := len(syncs); l != 1 {
+		t.Fatal("syncs should have 1 element:", l)
+	}
+
+	s := syncs[0]
+	if s.Op != SyncSetAttr {
+		t.Fatal("s should set an attribute:", s.Op)
+	}
+	if s.ID != root.Children[1].ID {
+		t.Fatal("s.ID should be the input id")
+	}
+	if s.Attr != "placeholder" || s.Value != c.Placeholder {
+		t.Fatalf(`s should set placeholder="%s": %s="%s"`, c.Placeholder, s.Attr, s.Value)
+	}
+}
+
+func testEnvPatchReplace(t *testing.T, env *env, c *Hello) {
+	root, err := env.Mount(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.Dismount(c)
+
+	c.Name = "Maxence"
+
+	syncs, err := env.Update(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := len(syncs); l != 1 {
+		t.Fatal("syncs should have 1 element:", l)
+	}
+
+	s := syncs[0]
+	if s.Op != SyncReplace {
+		t.Fatal("s should be a replacement:", s.Op)
+	}
+	if s.ParentID != root.Children[2].ID {
+		t.Fatal("s.ParentID should be the p id")
+	}
+	if s.Tag.Name != "markup.world" {
+		t.Fatal("replacement tag should be a markup.world:", s.Tag.Name)
+	}
+}
+
+func testEnvPatchChildren(t *testing.T, env *env, c *Hello) {
+	if _, err := env.Mount(c); err != nil {
+		t.Fatal(err)
+	}
+	defer env.Dismount(c)
+
+	c.TextBye = true
+
+	syncs, err := env.Update(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := len(syncs); l != 2 {
+		t.Fatal("syncs should have 2 elements:", l)
+	}
+
+	if s := syncs[0]; s.Op != SyncRemove || s.Index != 4 {
+		t.Fatalf("first sync should remove child 4: %v %v", s.Op, s.Index)
+	}
+
+	s := syncs[1]
+	if s.Op != SyncReplace || s.Index != 3 {
+		t.Fatalf("second sync should replace child 3: %v %v", s.Op, s.Index)
+	}
+	if s.Tag.Text != "Goodbye" {
+		t.Fatalf(`replacement text should be "Goodbye": "%s"`, s.Tag.Text)
+	}
+}
+
+func testEnvPatchComponent(t *testing.T, env *env, c *Hello) {
+	if _, err := env.Mount(c); err != nil {
+		t.Fatal(err)
+	}
+	defer env.Dismount(c)
+
+	c.Name = "Maxence"
+
+	syncs, err := env.Update(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := len(syncs); l != 1 {
+		t.Fatal("syncs should have 1 element:", l)
+	}
+
+	s := syncs[0]
+	if s.Op != SyncSetText {
+		t.Fatal("s should set a text:", s.Op)
+	}
+	if s.Value != c.Name {
+		t.Fatalf(`s.Value should be "%s": "%s"`, c.Name, s.Value)
+	}
+}
+
+func BenchmarkMount(b *testing.B) {
+	bui := NewCompoBuilder()
+	bui.Register(&Hello{})
+	bui.Register(&World{})
+
+	env := newEnv(bui)
+
+	for i := 0; i < b.N; i++ {
+		hello := &Hello{
+			Name: "JonhyMaxoo",
+		}
+		env.Mount(hello)
+		env.Dismount(hello)
+	}
+}
+
+func BenchmarkSync(b *testing.B) {
+	bui := NewCompoBuilder()
+	bui.Register(&Hello{})
+	bui.Register(&World{})
+
+	env := newEnv(bui)
+
+	hello := &Hello{
+		Name: "JonhyMaxoo",
+	}
+	env.Mount(hello)
+
+	alt := false
+
+	for i := 0; i < b.N; i++ {
+		if alt {
+			hello.Greeting = "Jon"
+		} else {
+			hello.Greeting = ""
+		}
+		hello.TextBye = alt
+		hello.Placeholder = strconv.Itoa(i)
+		hello.Greeting = strconv.Itoa(i)
+
+		env.Update(hello)
+
+		alt = !alt
+	}
+}
+
+type Card ZeroCompo
+
+func (c *Card) Render() string {
+	return `
+<div>
+	<header><slot name="header"></slot></header>
+	<slot></slot>
+</div>
+	`
+}
+
+type CardPage struct {
+	Title string
+	Body  string
+	Name  string
+}
+
+func (p *CardPage) Render() string {
+	return `
+<div>
+	<markup.card>
+		<h1 slot="header">{{.Title}}</h1>
+		<p onclick="OnClick">{{.Body}}</p>
+		{{if .Name}}<markup.world name="{{.Name}}">{{end}}
+	</markup.card>
+</div>
+	`
+}
+
+func (p *CardPage) OnClick() {}
+
+type CardLayout ZeroCompo
+
+func (l *CardLayout) Render() string {
+	return `
+<section>
+	<markup.card>
+		<span slot="header">layout</span>
+		<slot></slot>
+	</markup.card>
+</section>
+	`
+}
+
+type CardLayoutPage struct {
+	Body string
+}
+
+func (p *CardLayoutPage) Render() string {
+	return `
+<main>
+	<markup.cardlayout>
+		<p>{{.Body}}</p>
+	</markup.cardlayout>
+</main>
+	`
+}
+
+func TestEnvSlots(t *testing.T) {
+	b := NewCompoBuilder()
+	b.Register(&Card{})
+	b.Register(&CardPage{})
+	b.Register(&CardLayout{})
+	b.Register(&CardLayoutPage{})
+	b.Register(&World{})
+
+	tests := []struct {
+		name string
+		test func(t *testing.T, env *env)
+	}{
+		{
+			name: "mount projects children",
+			test: func(t *testing.T, env *env) { testEnvSlotsMount(t, env, &CardPage{Title: "Hello", Body: "World"}) },
+		},
+		{
+			name: "update projected children",
+			test: func(t *testing.T, env *env) { testEnvSlotsUpdate(t, env, &CardPage{Title: "Hello", Body: "World"}) },
+		},
+		{
+			name: "forward slot",
+			test: func(t *testing.T, env *env) { testEnvSlotsForward(t, env, &CardLayoutPage{Body: "Hello"}) },
+		},
+	}
+
+	modes := []struct {
+		name string
+		mode SyncMode
+	}{
+		{name: "full", mode: FullSyncMode},
+		{name: "patch", mode: PatchSyncMode},
+	}
+
+	for _, m := range modes {
+		for _, test := range tests {
+			env := newEnv(b, WithSyncMode(m.mode))
+			t.Run(m.name+" "+test.name, func(t *testing.T) { test.test(t, env) })
+		}
+	}
+}
+
+// cardSlots returns the slots of the card mounted as the first child of root.
+func cardSlots(t *testing.T, env *env, root Tag) (header Tag, body Tag) {
+	card, err := env.Component(root.Children[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cardRoot, _ := env.Root(card)
+	return cardRoot.Children[0].Children[0], cardRoot.Children[1]
+}
+
+func testEnvSlotsMount(t *testing.T, env *env, c *CardPage) {
+	root, err := env.Mount(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.Dismount(c)
+
+	header, body := cardSlots(t, env, root)
+
+	if l := len(header.Children); l != 1 {
+		t.Fatal("header slot should have 1 child:", l)
+	}
+	if text := header.Children[0].Children[0].Text; text != "Hello" {
+		t.Fatal("header text should be Hello:", text)
+	}
+
+	if l := len(body.Children); l != 1 {
+		t.Fatal("body slot should have 1 child:", l)
+	}
+	if compoID := body.Children[0].CompoID; compoID != root.CompoID {
+		t.Fatal("projected tag should belong to the page:", compoID)
+	}
+	if body.Children[0].ID == uuid.Nil {
+		t.Fatal("projected tag should be mounted")
+	}
+
+	if l := len(root.Children[0].Children); l != 2 {
+		t.Fatal("card tag should have 2 children:", l)
+	}
+	if id := root.Children[0].Children[0].ID; id != uuid.Nil {
+		t.Fatal("card tag children should not be mounted:", id)
+	}
+}
+
+func testEnvSlotsUpdate(t *testing.T, env *env, c *CardPage) {
+	root, err := env.Mount(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.Dismount(c)
+
+	count := len(env.components)
+
+	c.Body = "Maxence"
+	c.Name = "Max"
+
+	syncs, err := env.Update(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(syncs) == 0 {
+		t.Fatal("syncs should not be empty")
+	}
+
+	header, body := cardSlots(t, env, root)
+	if text := header.Children[0].Children[0].Text; text != "Hello" {
+		t.Fatal("header text should be Hello:", text)
+	}
+	if l := len(body.Children); l != 2 {
+		t.Fatal("body slot should have 2 children:", l)
+	}
+	if text := body.Children[0].Children[0].Text; text != "Maxence" {
+		t.Fatal("body text should be Maxence:", text)
+	}
+	if l := len(env.components); l != count+1 {
+		t.Fatal("projected component should be mounted:", l)
+	}
+
+	c.Name = ""
+	if _, err = env.Update(c); err != nil {
+		t.Fatal(err)
+	}
+	if l := len(env.components); l != count {
+		t.Fatal("projected component should be dismounted:", l)
+	}
+
+	if syncs, err = env.Update(c); err != nil {
+		t.Fatal(err)
+	}
+	if l := len(syncs); l != 0 {
+		t.Fatal("syncs should be empty:", l)
+	}
+}
+
+func testEnvSlotsForward(t *testing.T, env *env, c *CardLayoutPage) {
+	root, err := env.Mount(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.Dismount(c)
+
+	layout, _ := env.Component(root.Children[0].ID)
+	layoutRoot, _ := env.Root(layout)
+
+	header, body := cardSlots(t, env, layoutRoot)
+	if text := header.Children[0].Children[0].Text; text != "layout" {
+		t.Fatal("header text should be layout:", text)
+	}
+
+	forwarded := body.Children[0]
+	if !isSlot(&forwarded) {
+		t.Fatal("body slot should contain the layout slot:", forwarded.Name)
+	}
+	if forwarded.Children[0].CompoID != root.CompoID {
+		t.Fatal("forwarded tag should belong to the page")
+	}
+
+	c.Body = "World"
+	if _, err = env.Update(c); err != nil {
+		t.Fatal(err)
+	}
+
+	_, body = cardSlots(t, env, layoutRoot)
+	if text := body.Children[0].Children[0].Children[0].Text; text != "World" {
+		t.Fatal("forwarded text should be World:", text)
+	}
+}
+
+// lifecycleEvents records the hooks called on LifecycleParent and
+// LifecycleChild.
+var lifecycleEvents []string
+
+type LifecycleParent struct {
+	Value int
+}
+
+func (p *LifecycleParent) Render() string {
+	return `
+<div>
+	<markup.lifecyclechild value="{{.Value}}">
+</div>
+	`
+}
+
+func (p *LifecycleParent) OnUpdate() {
+	lifecycleEvents = append(lifecycleEvents, "parent update")
+}
+
+type LifecycleChild struct {
+	Value int
+}
+
+func (c *LifecycleChild) Render() string {
+	return `<p>{{.Value}}</p>`
+}
+
+func (c *LifecycleChild) OnPropsChange(oldAttrs, newAttrs AttrMap) {
+	lifecycleEvents = append(lifecycleEvents, "child props "+oldAttrs["value"]+" "+newAttrs["value"]+" "+strconv.Itoa(c.Value))
+}
+
+func (c *LifecycleChild) ShouldUpdate(oldAttrs, newAttrs AttrMap) bool {
+	lifecycleEvents = append(lifecycleEvents, "child should update "+oldAttrs["value"]+" "+newAttrs["value"])
+	return newAttrs["value"] != "42"
+}
+
+func (c *LifecycleChild) OnUpdate() {
+	lifecycleEvents = append(lifecycleEvents, "child update")
+}
+
+func TestEnvLifecycle(t *testing.T) {
+	b := NewCompoBuilder()
+	b.Register(&LifecycleParent{})
+	b.Register(&LifecycleChild{})
+
+	tests := []struct {
+		name     string
+		value    int
+		syncs    int
+		expected []string
+	}{
+		{
+			name:  "update",
+			value: 1,
+			syncs: 1,
+			expected: []string{
+				"child props 0 1 1",
+				"child should update 0 1",
+				"child update",
+				"parent update",
+			},
+		},
+		{
+			name:  "vetoed update",
+			value: 42,
+			syncs: 0,
+			expected: []string{
+				"child props 0 42 42",
+				"child should update 0 42",
+				"parent update",
+			},
+		},
+		{
+			name:  "no change",
+			value: 0,
+			syncs: 0,
+			expected: []string{
+				"parent update",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			env := NewEnv(b)
+			parent := &LifecycleParent{}
+
+			if _, err := env.Mount(parent); err != nil {
+				t.Fatal(err)
+			}
+			defer env.Dismount(parent)
+
+			lifecycleEvents = nil
+			parent.Value = test.value
+
+			syncs, err := env.Update(parent)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if l := len(syncs); l != test.syncs {
+				t.Fatalf("syncs should have %v elements: %v", test.syncs, l)
+			}
+
+			if !reflect.DeepEqual(lifecycleEvents, test.expected) {
+				t.Fatalf("events should be %q: %q", test.expected, lifecycleEvents)
+			}
+		})
+	}
+}
+
+type Boundary struct {
+	Broken  bool
+	failure string
+}
+
+func (b *Boundary) Render() string {
+	return `
+<div>
+	{{if .Failure}}
+		<p>{{.Failure}}</p>
+	{{else}}
+		<markup.world name="boundary" err="{{.Broken}}">
+	{{end}}
+</div>
+	`
+}
+
+func (b *Boundary) Failure() string {
+	return b.failure
+}
+
+func (b *Boundary) OnError(err error) {
+	b.failure = err.Error()
+}
+
+type BoundaryPage struct {
+	Broken bool
+}
+
+func (p *BoundaryPage) Render() string {
+	return `
+<div>
+	<h1>boundary</h1>
+	<markup.boundary broken="{{.Broken}}">
+	<p>after</p>
+</div>
+	`
+}
+
+func TestEnvErrorBoundary(t *testing.T) {
+	b := NewCompoBuilder()
+	b.Register(&BoundaryPage{})
+	b.Register(&Boundary{})
+	b.Register(&World{})
+
+	tests := []struct {
+		name string
+		test func(t *testing.T, env *env)
+	}{
+		{
+			name: "mount renders fallback",
+			test: func(t *testing.T, env *env) { testEnvErrorBoundaryMount(t, env, &BoundaryPage{Broken: true}) },
+		},
+		{
+			name: "update renders fallback",
+			test: func(t *testing.T, env *env) { testEnvErrorBoundaryUpdate(t, env, &BoundaryPage{}) },
+		},
+		{
+			name: "nested update renders fallback",
+			test: func(t *testing.T, env *env) { testEnvErrorBoundaryNestedUpdate(t, env, &BoundaryPage{}, false) },
+		},
+		{
+			name: "nested flush renders fallback",
+			test: func(t *testing.T, env *env) { testEnvErrorBoundaryNestedUpdate(t, env, &BoundaryPage{}, true) },
+		},
+	}
+
+	modes := []struct {
+		name string
+		mode SyncMode
+	}{
+		{name: "full", mode: FullSyncMode},
+		{name: "patch", mode: PatchSyncMode},
+	}
+
+	for _, m := range modes {
+		for _, test := range tests {
+			env := newEnv(b, WithSyncMode(m.mode))
+			t.Run(m.name+" "+test.name, func(t *testing.T) { test.test(t, env) })
+		}
+	}
+}
+
+// testEnvErrorBoundaryFallback checks that the boundary mounted in the page
+// described by root renders its fallback.
+func testEnvErrorBoundaryFallback(t *testing.T, env *env, root Tag) {
+	if l := len(root.Children); l != 3 {
+		t.Fatal("page should have 3 children:", l)
+	}
+
+	c, err := env.Component(root.Children[1].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	boundary := c.(*Boundary)
+	if len(boundary.failure) == 0 {
+		t.Fatal("boundary should have handled an error")
+	}
+	t.Log(boundary.failure)
+
+	boundaryRoot, _ := env.Root(boundary)
+	if name := boundaryRoot.Children[0].Name; name != "p" {
+		t.Fatal("boundary should render its fallback:", name)
+	}
+
+	// Only the page and the boundary are mounted: the world that failed to
+	// mount its child has been dismounted.
+	if l := len(env.components); l != 2 {
+		t.Fatal("env should have 2 components:", l)
+	}
+}
+
+func testEnvErrorBoundaryMount(t *testing.T, env *env, c *BoundaryPage) {
+	root, err := env.Mount(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.Dismount(c)
+
+	testEnvErrorBoundaryFallback(t, env, root)
+}
+
+func testEnvErrorBoundaryUpdate(t *testing.T, env *env, c *BoundaryPage) {
+	if _, err := env.Mount(c); err != nil {
+		t.Fatal(err)
+	}
+	defer env.Dismount(c)
+
+	c.Broken = true
+
+	syncs, err := env.Update(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(syncs) == 0 {
+		t.Fatal("syncs should not be empty")
+	}
+
+	root, _ := env.Root(c)
+	testEnvErrorBoundaryFallback(t, env, root)
+}
+
+func testEnvErrorBoundaryNestedUpdate(t *testing.T, env *env, c *BoundaryPage, flush bool) {
+	if _, err := env.Mount(c); err != nil {
+		t.Fatal(err)
+	}
+	defer env.Dismount(c)
+
+	var world *World
+	for _, c := range env.components {
+		if w, ok := c.(*World); ok {
+			world = w
+		}
+	}
+	if world == nil {
+		t.Fatal("env should have a world")
+	}
+
+	world.Err = true
+
+	var syncs []Sync
+	var err error
+
+	if flush {
+		env.MarkDirty(world)
+		syncs, err = env.Flush()
+	} else {
+		syncs, err = env.Update(world)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(syncs) == 0 {
+		t.Fatal("syncs should not be empty")
+	}
+
+	root, _ := env.Root(c)
+	testEnvErrorBoundaryFallback(t, env, root)
 }
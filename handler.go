@@ -0,0 +1,150 @@
+package markup
+
+import (
+	"bytes"
+	"html"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Handler is an http.Handler that renders a component server side.
+//
+// For each request, it creates the component named Component, maps the path
+// parameters and the query parameters of the request URL to the component
+// fields, calls its OnNavigate method if it implements Navigator and mounts
+// it. The component is then written as a full HTML5 document and dismounted.
+//
+// Parameters are mapped to the fields with the same rules as attributes:
+// a parameter named id is mapped to the field named ID.
+type Handler struct {
+	// Builder is the compo builder used to create the component and its
+	// children.
+	Builder CompoBuilder
+
+	// Component is the name of the component to render.
+	Component string
+
+	// Pattern describes the request URL paths handled. Path elements written
+	// between braces are path parameters, e.g. "/users/{id}".
+	// Requests that do not match result in a 404 error.
+	// An empty pattern matches every path and does not define parameters.
+	Pattern string
+
+	// Title is the title of the HTML document.
+	Title string
+
+	// Head is raw HTML written in the head of the document, after the title.
+	// It can be used to add stylesheets or scripts.
+	Head string
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	params, ok := matchPattern(h.Pattern, r.URL.Path)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	c, err := h.Builder.New(h.Component)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err = mapComponentFields(c, urlAttrs(*r.URL, params)); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if navigator, ok := c.(Navigator); ok {
+		navigator.OnNavigate(*r.URL)
+	}
+
+	b := bytes.Buffer{}
+	if err = h.render(&b, c); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	b.WriteTo(w)
+}
+
+func (h *Handler) render(b *bytes.Buffer, c Componer) error {
+	env := NewEnv(h.Builder)
+
+	root, err := env.Mount(c)
+	if err != nil {
+		return errors.Wrapf(err, "fail to render %s", h.Component)
+	}
+	defer env.Dismount(c)
+
+	b.WriteString("<!DOCTYPE html>\n<html>\n<head>\n")
+	b.WriteString(`<meta charset="utf-8">`)
+	b.WriteString("\n<title>")
+	b.WriteString(html.EscapeString(h.Title))
+	b.WriteString("</title>\n")
+	if len(h.Head) != 0 {
+		b.WriteString(h.Head)
+		b.WriteRune('\n')
+	}
+	b.WriteString("</head>\n<body>\n")
+
+	enc := NewTagEncoder(b, env)
+	if err = enc.Encode(root); err != nil {
+		return errors.Wrapf(err, "fail to render %s", h.Component)
+	}
+
+	b.WriteString("\n</body>\n</html>\n")
+	return nil
+}
+
+// matchPattern reports whether path matches pattern and returns the path
+// parameters it defines.
+func matchPattern(pattern, path string) (params map[string]string, ok bool) {
+	if len(pattern) == 0 {
+		return nil, true
+	}
+
+	patternElems := strings.Split(strings.Trim(pattern, "/"), "/")
+	pathElems := strings.Split(strings.Trim(path, "/"), "/")
+
+	if len(patternElems) != len(pathElems) {
+		return nil, false
+	}
+
+	params = make(map[string]string)
+
+	for i, elem := range patternElems {
+		if strings.HasPrefix(elem, "{") && strings.HasSuffix(elem, "}") {
+			params[elem[1:len(elem)-1]] = pathElems[i]
+			continue
+		}
+
+		if elem != pathElems[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// urlAttrs returns the attributes described by the query parameters of u and
+// the path parameters params.
+// Names are converted to lower case. Path parameters take precedence over
+// query parameters.
+func urlAttrs(u url.URL, params map[string]string) AttrMap {
+	query := u.Query()
+	attrs := make(AttrMap, len(query)+len(params))
+
+	for k, v := range query {
+		attrs[strings.ToLower(k)] = v[0]
+	}
+
+	for k, v := range params {
+		attrs[strings.ToLower(k)] = v
+	}
+	return attrs
+}
@@ -0,0 +1,154 @@
+package markup
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+type Page struct {
+	ID        int
+	Name      string
+	navigated bool
+}
+
+func (p *Page) Render() string {
+	return `
+<div>
+	<h1>{{.Name}} {{.ID}}</h1>
+	<markup.world name="{{.Name}}">
+	{{if .Navigated}}<p>navigated</p>{{end}}
+</div>
+	`
+}
+
+func (p *Page) Navigated() bool {
+	return p.navigated
+}
+
+func (p *Page) OnNavigate(u url.URL) {
+	p.navigated = true
+}
+
+func TestHandler(t *testing.T) {
+	b := NewCompoBuilder()
+	b.Register(&Page{})
+	b.Register(&World{})
+	b.Register(&CompoBadTmpl{})
+
+	tests := []struct {
+		name    string
+		handler *Handler
+		target  string
+		code    int
+		body    []string
+	}{
+		{
+			name: "render component",
+			handler: &Handler{
+				Builder:   b,
+				Component: "markup.page",
+				Pattern:   "/users/{id}",
+				Title:     "<Users>",
+				Head:      `<link rel="stylesheet" href="style.css">`,
+			},
+			target: "/users/42?name=Max",
+			code:   http.StatusOK,
+			body: []string{
+				"<!DOCTYPE html>",
+				"<title>&lt;Users&gt;</title>",
+				`<link rel="stylesheet" href="style.css">`,
+				"Max 42",
+				"navigated",
+			},
+		},
+		{
+			name: "render component without pattern",
+			handler: &Handler{
+				Builder:   b,
+				Component: "markup.page",
+			},
+			target: "/whatever?id=21",
+			code:   http.StatusOK,
+			body:   []string{"21"},
+		},
+		{
+			name: "path not matching pattern",
+			handler: &Handler{
+				Builder:   b,
+				Component: "markup.page",
+				Pattern:   "/users/{id}",
+			},
+			target: "/posts/42",
+			code:   http.StatusNotFound,
+		},
+		{
+			name: "bad parameter",
+			handler: &Handler{
+				Builder:   b,
+				Component: "markup.page",
+			},
+			target: "/?id=abc",
+			code:   http.StatusBadRequest,
+		},
+		{
+			name: "not registered component",
+			handler: &Handler{
+				Builder:   b,
+				Component: "markup.unknown",
+			},
+			target: "/",
+			code:   http.StatusInternalServerError,
+		},
+		{
+			name: "component with bad template",
+			handler: &Handler{
+				Builder:   b,
+				Component: "markup.compobadtmpl",
+			},
+			target: "/",
+			code:   http.StatusInternalServerError,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, test.target, nil)
+			test.handler.ServeHTTP(w, r)
+
+			if w.Code != test.code {
+				t.Fatalf("status code should be %v: %v", test.code, w.Code)
+			}
+
+			body := w.Body.String()
+			for _, s := range test.body {
+				if !strings.Contains(body, s) {
+					t.Errorf("body should contain %s: %s", s, body)
+				}
+			}
+		})
+	}
+}
+
+func TestMatchPattern(t *testing.T) {
+	params, ok := matchPattern("/users/{id}/posts/{post}", "/users/42/posts/21/")
+	if !ok {
+		t.Fatal("path should match pattern")
+	}
+	if id := params["id"]; id != "42" {
+		t.Errorf(`id should be "42": "%s"`, id)
+	}
+	if post := params["post"]; post != "21" {
+		t.Errorf(`post should be "21": "%s"`, post)
+	}
+
+	if _, ok = matchPattern("/users/{id}", "/users"); ok {
+		t.Error("path should not match pattern")
+	}
+	if _, ok = matchPattern("/users/{id}", "/posts/42"); ok {
+		t.Error("path should not match pattern")
+	}
+}
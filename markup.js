@@ -0,0 +1,207 @@
+// Runtime served by Bridge.
+//
+// It implements CallGoHandler, the function called by the event handlers
+// written by TagEncoder, and applies the syncs sent back by the bridge to the
+// DOM. See WireSync and WireNode for the format of the syncs.
+(function () {
+  'use strict';
+
+  var svgNS = 'http://www.w3.org/2000/svg';
+  var url = document.currentScript.src.replace(/^http/, 'ws');
+  var socket = new WebSocket(url);
+  var queue = [];
+
+  socket.onopen = function () {
+    queue.forEach(function (msg) {
+      socket.send(msg);
+    });
+    queue = [];
+  };
+
+  socket.onmessage = function (msg) {
+    var res = JSON.parse(msg.data);
+    var syncs = res.Syncs || [];
+
+    // A failed update comes with the syncs that rebuild the component.
+    if (res.Error) {
+      console.error(res.Error);
+      if (syncs.length === 0) {
+        return;
+      }
+    }
+
+    try {
+      syncs.forEach(applySync);
+    } catch (err) {
+      console.error(err);
+    }
+    window.dispatchEvent(new CustomEvent('markup:syncs', { detail: syncs }));
+  };
+
+  // The argument sent with an event is the value of the element that
+  // triggered it when it has one (checked state for checkboxes and radio
+  // buttons), or a description of the event otherwise.
+  function eventArg(self, event) {
+    if (self.type === 'checkbox' || self.type === 'radio') {
+      return self.checked;
+    }
+    if (self.value !== undefined) {
+      return self.value;
+    }
+    return {
+      Type: event.type,
+      Key: event.key,
+      ClientX: event.clientX,
+      ClientY: event.clientY
+    };
+  }
+
+  window.CallGoHandler = function (compoID, target, self, event) {
+    var msg = JSON.stringify({
+      CompoID: compoID,
+      Target: target,
+      Arg: JSON.stringify(eventArg(self, event))
+    });
+
+    if (socket.readyState !== WebSocket.OPEN) {
+      queue.push(msg);
+      return;
+    }
+    socket.send(msg);
+  };
+
+  function findByID(id) {
+    var el = document.querySelector('[data-go-id="' + id + '"]') ||
+      document.querySelector('[data-go-compo-id~="' + id + '"]');
+    if (!el) {
+      throw new Error('no element with id ' + id);
+    }
+    return el;
+  }
+
+  // childNodes returns the nodes that match the children of the tag rendered
+  // as el: elements and non blank texts.
+  function childNodes(el) {
+    var nodes = [];
+    for (var i = 0; i < el.childNodes.length; i++) {
+      var node = el.childNodes[i];
+      if (node.nodeType === 1 || (node.nodeType === 3 && node.nodeValue.trim().length !== 0)) {
+        nodes.push(node);
+      }
+    }
+    return nodes;
+  }
+
+  function childNode(parent, index) {
+    var node = childNodes(parent)[index];
+    if (!node) {
+      throw new Error('no child at position ' + index);
+    }
+    return node;
+  }
+
+  function createNode(node) {
+    if (!node.Name) {
+      return document.createTextNode(node.Text || '');
+    }
+
+    var el = node.Svg ? document.createElementNS(svgNS, node.Name) : document.createElement(node.Name);
+    setAttrs(el, node.Attrs);
+
+    (node.Children || []).forEach(function (child) {
+      el.appendChild(createNode(child));
+    });
+    return el;
+  }
+
+  // setAttrs sets the attributes of el to attrs. Ids are preserved.
+  function setAttrs(el, attrs) {
+    attrs = attrs || {};
+
+    el.getAttributeNames().forEach(function (name) {
+      if (!(name in attrs) && name.indexOf('data-go-') !== 0) {
+        el.removeAttribute(name);
+      }
+    });
+
+    Object.keys(attrs).forEach(function (name) {
+      el.setAttribute(name, attrs[name]);
+    });
+  }
+
+  function replaceNode(old, node) {
+    old.parentNode.replaceChild(createNode(node), old);
+  }
+
+  // rebuildNode replaces old by node. node stays the root of the same
+  // components.
+  function rebuildNode(old, node) {
+    if (node.Attrs && old.getAttribute('data-go-compo-id') !== null) {
+      node.Attrs['data-go-compo-id'] = old.getAttribute('data-go-compo-id');
+    }
+    replaceNode(old, node);
+  }
+
+  function applySync(sync) {
+    var parent, node, nodes;
+
+    switch (sync.Op) {
+      case 'tag':
+        if (sync.Full) {
+          rebuildNode(findByID(sync.ID), sync.Node);
+          return;
+        }
+        setAttrs(findByID(sync.ID), sync.Node.Attrs);
+        return;
+
+      case 'insert':
+        parent = findByID(sync.ParentID);
+        nodes = childNodes(parent);
+        parent.insertBefore(createNode(sync.Node), nodes[sync.Index] || null);
+        return;
+
+      case 'move':
+        parent = findByID(sync.ParentID);
+        node = childNode(parent, sync.OldIndex);
+        parent.removeChild(node);
+        nodes = childNodes(parent);
+        parent.insertBefore(node, nodes[sync.Index] || null);
+        return;
+
+      case 'remove':
+        parent = findByID(sync.ParentID);
+        parent.removeChild(childNode(parent, sync.Index));
+        return;
+
+      case 'setAttr':
+        findByID(sync.ID).setAttribute(sync.Attr, sync.Value);
+        return;
+
+      case 'removeAttr':
+        findByID(sync.ID).removeAttribute(sync.Attr);
+        return;
+
+      case 'setText':
+        parent = findByID(sync.ParentID);
+        node = childNode(parent, sync.Index);
+        if (node.nodeType === 3) {
+          node.nodeValue = sync.Value;
+          return;
+        }
+        parent.replaceChild(document.createTextNode(sync.Value), node);
+        return;
+
+      case 'replace':
+        if (sync.ParentID) {
+          parent = findByID(sync.ParentID);
+          replaceNode(childNode(parent, sync.Index), sync.Node);
+          return;
+        }
+        rebuildNode(findByID(sync.ID), sync.Node);
+        return;
+
+      default:
+        throw new Error('unknown sync operation ' + sync.Op);
+    }
+  }
+})();
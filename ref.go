@@ -0,0 +1,138 @@
+package markup
+
+import (
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+const (
+	// refPrefix starts the handles returned by ref. Handles are made of
+	// letters, digits and dashes in order to be written unchanged by
+	// html/template, whatever the context of the attribute, URLs included.
+	refPrefix = "markup-ref-"
+
+	// refAttr is the value of the attributes that pass a value by reference,
+	// once resolved.
+	refAttr = "markup-ref"
+)
+
+var refUsage = regexp.MustCompile(`\bref\b`)
+
+// refTable stores the values passed by reference with the ref template
+// function during the rendering of a component.
+type refTable struct {
+	// prefix starts the handles returned by ref. It is random in order to
+	// prevent rendered strings from being taken for handles.
+	prefix string
+	values []interface{}
+}
+
+func newRefTable() *refTable {
+	return &refTable{
+		prefix: refPrefix + uuid.New().String() + "-",
+	}
+}
+
+// ref stores v in the table and returns the handle that refers to it.
+func (r *refTable) ref(v interface{}) (string, error) {
+	r.values = append(r.values, v)
+	return r.prefix + strconv.Itoa(len(r.values)-1), nil
+}
+
+// unboundRef is the ref function used to parse templates. It is replaced by
+// the one of a refTable when a template is executed.
+func unboundRef(v interface{}) (string, error) {
+	return "", errors.New("ref is not bound to a rendering")
+}
+
+// resolve sets the values referred by the attributes of the component tags in
+// the tree t, which is rendered by owner. The values of the attributes are
+// replaced by refAttr in order to be the same from a rendering to another.
+func (r *refTable) resolve(t *Tag, owner Componer) error {
+	if t.IsComponent() {
+		for name, val := range t.Attrs {
+			if len(r.prefix) == 0 || !strings.HasPrefix(val, r.prefix) {
+				continue
+			}
+
+			i, err := strconv.Atoi(val[len(r.prefix):])
+			if err != nil || i < 0 || i >= len(r.values) {
+				return errors.Errorf(`%s="%s" is not a valid reference`, name, val)
+			}
+
+			if t.values == nil {
+				t.values = make(map[string]interface{})
+			}
+			t.values[name] = r.values[i]
+			t.Attrs[name] = refAttr
+		}
+
+		methodRefs(t, owner)
+	}
+
+	for i := range t.Children {
+		if err := r.resolve(&t.Children[i], owner); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mapComponentValue sets the field f to v, which is passed by reference.
+func mapComponentValue(f reflect.Value, v interface{}) error {
+	val := reflect.ValueOf(v)
+	if !val.IsValid() {
+		f.Set(reflect.Zero(f.Type()))
+		return nil
+	}
+
+	if !val.Type().AssignableTo(f.Type()) {
+		return errors.Errorf("%v is not assignable to %v", val.Type(), f.Type())
+	}
+	f.Set(val)
+	return nil
+}
+
+// valuesEqual reports whether the values passed by reference l and r are the
+// same.
+func valuesEqual(l, r map[string]interface{}) bool {
+	if len(l) != len(r) {
+		return false
+	}
+
+	for k, v := range l {
+		rv, ok := r[k]
+		if !ok || !sameRef(v, rv) {
+			return false
+		}
+	}
+	return true
+}
+
+// sameRef reports whether a and b are the same value. Pointers, maps, slices
+// and channels are the same when they refer to the same memory. Functions
+// are never the same since they can't be compared.
+func sameRef(a, b interface{}) bool {
+	va := reflect.ValueOf(a)
+	vb := reflect.ValueOf(b)
+	if !va.IsValid() || !vb.IsValid() || va.Type() != vb.Type() {
+		return sameValue(a, b)
+	}
+
+	switch va.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Chan, reflect.UnsafePointer:
+		return va.Pointer() == vb.Pointer()
+
+	case reflect.Slice:
+		return va.Pointer() == vb.Pointer() && va.Len() == vb.Len()
+
+	case reflect.Func:
+		return false
+	}
+	return sameValue(a, b)
+}
@@ -0,0 +1,341 @@
+package markup
+
+import (
+	"net/url"
+	"testing"
+)
+
+type RefItem struct {
+	Name string
+}
+
+type RefList struct {
+	Title    string
+	Items    []string
+	Selected *RefItem
+	Renders  int `markup:"-"`
+}
+
+func (l *RefList) Render() string {
+	l.Renders++
+
+	return `
+<ul>
+	{{range .Items}}
+		<li>{{.}}</li>
+	{{end}}
+</ul>
+	`
+}
+
+type RefListPage struct {
+	Items    []string
+	Selected *RefItem
+}
+
+func (p *RefListPage) Render() string {
+	return `
+<div>
+	<markup.reflist items="{{ref .Items}}" selected="{{ref .Selected}}">
+</div>
+	`
+}
+
+type RefBadPage struct {
+	Items []int
+}
+
+func (p *RefBadPage) Render() string {
+	return `<div><markup.reflist items="{{ref .Items}}"></div>`
+}
+
+type RefRawPage struct {
+	Items []string
+}
+
+func (p *RefRawPage) Render() string {
+	return `<div><markup.reflist items="{{ref .Items}}"></div>`
+}
+
+func (p *RefRawPage) RawRender() bool {
+	return true
+}
+
+func TestRef(t *testing.T) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, env *env, p *RefListPage)
+	}{
+		{
+			name: "mount shares values",
+			test: testRefMount,
+		},
+		{
+			name: "update with same values",
+			test: testRefUpdateSame,
+		},
+		{
+			name: "update with other values",
+			test: testRefUpdateOther,
+		},
+		{
+			name: "update with nil value",
+			test: testRefUpdateNil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b := NewCompoBuilder()
+			b.Register(&RefList{})
+			b.Register(&RefListPage{})
+
+			env := newEnv(b)
+			p := &RefListPage{
+				Items:    []string{"a", "b"},
+				Selected: &RefItem{Name: "a"},
+			}
+
+			if _, err := env.Mount(p); err != nil {
+				t.Fatal(err)
+			}
+			defer env.Dismount(p)
+
+			test.test(t, env, p)
+		})
+	}
+}
+
+// refList returns the list mounted in env.
+func refList(t *testing.T, env *env) *RefList {
+	for _, c := range env.components {
+		if l, ok := c.(*RefList); ok {
+			return l
+		}
+	}
+	t.Fatal("env should have a list")
+	return nil
+}
+
+func testRefMount(t *testing.T, env *env, p *RefListPage) {
+	l := refList(t, env)
+
+	if l.Selected != p.Selected {
+		t.Fatal("list selected item should be the page one:", l.Selected)
+	}
+	if len(l.Items) != 2 || &l.Items[0] != &p.Items[0] {
+		t.Fatal("list items should share the page items:", l.Items)
+	}
+
+	root, _ := env.Root(l)
+	if l := len(root.Children); l != 2 {
+		t.Fatal("list root should have 2 children:", l)
+	}
+}
+
+func testRefUpdateSame(t *testing.T, env *env, p *RefListPage) {
+	p.Selected.Name = "b"
+
+	syncs, err := env.Update(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := len(syncs); l != 0 {
+		t.Fatal("syncs should be empty:", l)
+	}
+
+	if l := refList(t, env); l.Renders != 1 {
+		t.Fatal("list should have been rendered once:", l.Renders)
+	}
+}
+
+func testRefUpdateOther(t *testing.T, env *env, p *RefListPage) {
+	p.Items = append(p.Items, "c")
+
+	if _, err := env.Update(p); err != nil {
+		t.Fatal(err)
+	}
+
+	l := refList(t, env)
+	if l.Renders != 2 {
+		t.Fatal("list should have been rendered twice:", l.Renders)
+	}
+
+	root, _ := env.Root(l)
+	if l := len(root.Children); l != 3 {
+		t.Fatal("list root should have 3 children:", l)
+	}
+}
+
+func testRefUpdateNil(t *testing.T, env *env, p *RefListPage) {
+	p.Selected = nil
+
+	if _, err := env.Update(p); err != nil {
+		t.Fatal(err)
+	}
+
+	if l := refList(t, env); l.Selected != nil {
+		t.Fatal("list selected item should be nil:", l.Selected)
+	}
+}
+
+type RefForgedPage struct {
+	Input string
+	Items []string
+}
+
+func (p *RefForgedPage) Render() string {
+	return `<div><markup.reflist title="{{.Input}}" items="{{ref .Items}}"></div>`
+}
+
+type RefForgedNoRefPage struct {
+	Input string
+}
+
+func (p *RefForgedNoRefPage) Render() string {
+	return `<div><markup.reflist title="{{.Input}}"></div>`
+}
+
+func TestRefForged(t *testing.T) {
+	tests := []struct {
+		name  string
+		compo Componer
+	}{
+		{
+			name:  "with references",
+			compo: &RefForgedPage{Input: refPrefix + "0", Items: []string{"a"}},
+		},
+		{
+			name:  "without references",
+			compo: &RefForgedNoRefPage{Input: refPrefix + "0"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b := NewCompoBuilder()
+			b.Register(&RefList{})
+
+			env := newEnv(b)
+			if _, err := env.Mount(test.compo); err != nil {
+				t.Fatal(err)
+			}
+			defer env.Dismount(test.compo)
+
+			l := refList(t, env)
+			if l.Title != refPrefix+"0" {
+				t.Fatalf("list title should be %s: %s", refPrefix+"0", l.Title)
+			}
+
+			if p, ok := test.compo.(*RefForgedPage); ok && (len(l.Items) != 1 || &l.Items[0] != &p.Items[0]) {
+				t.Fatal("list items should share the page items:", l.Items)
+			}
+		})
+	}
+}
+
+func TestRefRaw(t *testing.T) {
+	b := NewCompoBuilder()
+	b.Register(&RefList{})
+
+	env := newEnv(b)
+	p := &RefRawPage{Items: []string{"a"}}
+
+	if _, err := env.Mount(p); err != nil {
+		t.Fatal(err)
+	}
+	defer env.Dismount(p)
+
+	if l := refList(t, env); len(l.Items) != 1 || &l.Items[0] != &p.Items[0] {
+		t.Fatal("list items should share the page items:", l.Items)
+	}
+}
+
+func TestRefNotAssignable(t *testing.T) {
+	b := NewCompoBuilder()
+	b.Register(&RefList{})
+
+	env := newEnv(b)
+	if _, err := env.Mount(&RefBadPage{Items: []int{42}}); err == nil {
+		t.Fatal("mounting a page with a reference to a bad type should return an error")
+	}
+}
+
+func TestSameRef(t *testing.T) {
+	item := &RefItem{}
+	items := []int{1, 2}
+
+	tests := []struct {
+		a, b interface{}
+		same bool
+	}{
+		{a: item, b: item, same: true},
+		{a: item, b: &RefItem{}, same: false},
+		{a: items, b: items, same: true},
+		{a: items, b: items[:1], same: false},
+		{a: 42, b: 42, same: true},
+		{a: 42, b: "42", same: false},
+		{a: nil, b: nil, same: true},
+		{a: testSameRefFunc, b: testSameRefFunc, same: false},
+		{a: SameValueItem{Value: items}, b: SameValueItem{Value: items}, same: false},
+	}
+
+	for _, test := range tests {
+		if same := sameRef(test.a, test.b); same != test.same {
+			t.Errorf("sameRef(%v, %v) should be %v", test.a, test.b, test.same)
+		}
+	}
+}
+
+func testSameRefFunc() {}
+
+type RefLink struct {
+	Href     *url.URL
+	ImageURL *url.URL
+}
+
+func (l *RefLink) Render() string {
+	return `<a href="{{.Href}}"><img src="{{.ImageURL}}"></a>`
+}
+
+type RefLinkPage struct {
+	Href     *url.URL
+	ImageURL *url.URL
+}
+
+func (p *RefLinkPage) Render() string {
+	return `<div><markup.reflink href="{{ref .Href}}" imageurl="{{ref .ImageURL}}"></div>`
+}
+
+func TestRefURLAttr(t *testing.T) {
+	b := NewCompoBuilder()
+	b.Register(&RefLink{})
+
+	env := newEnv(b)
+	p := &RefLinkPage{
+		Href:     &url.URL{Scheme: "https", Host: "example.com"},
+		ImageURL: &url.URL{Path: "/image.png"},
+	}
+
+	if _, err := env.Mount(p); err != nil {
+		t.Fatal(err)
+	}
+	defer env.Dismount(p)
+
+	var l *RefLink
+	for _, c := range env.components {
+		if c, ok := c.(*RefLink); ok {
+			l = c
+		}
+	}
+	if l == nil {
+		t.Fatal("env should have a link")
+	}
+
+	if l.Href != p.Href {
+		t.Fatal("link href should be the page one:", l.Href)
+	}
+	if l.ImageURL != p.ImageURL {
+		t.Fatal("link image url should be the page one:", l.ImageURL)
+	}
+}
@@ -0,0 +1,129 @@
+package markup
+
+import (
+	"net/url"
+
+	"github.com/pkg/errors"
+)
+
+// Router is the interface that describes a set of routes that map URL paths
+// to components.
+//
+// Routes should be registered before the router is used. Other methods are
+// safe for concurrent use.
+type Router interface {
+	// Route registers the component named compo for the URL paths that match
+	// pattern.
+	// Path elements written between braces are path parameters, e.g.
+	// "/users/{id}". Routes are matched in the order they are registered.
+	// err should be set if compo can't be created by the compo builder.
+	Route(pattern string, compo string) error
+
+	// Resolve creates the component routed for u.
+	// The path parameters and the query parameters of u are mapped to the
+	// component fields with the same rules as attributes.
+	// err should be set if no route matches u.
+	Resolve(u url.URL) (c Componer, err error)
+
+	// Mount resolves the component routed for u, calls its OnNavigate method
+	// if it implements Navigator and mounts it into env.
+	Mount(env Env, u url.URL) (c Componer, root Tag, err error)
+
+	// Navigate replaces page, a component mounted into env by the router, by
+	// the component routed for u. The new component is mounted as described
+	// by Mount and page is dismounted.
+	// It returns a SyncReplace operation that replaces the root of page by
+	// the root of the new component.
+	//
+	// If an error occurs, page stays mounted.
+	Navigate(env Env, page Componer, u url.URL) (c Componer, syncs []Sync, err error)
+}
+
+// NewRouter creates a router that creates components with b.
+func NewRouter(b CompoBuilder) Router {
+	return &router{
+		compoBuilder: b,
+	}
+}
+
+type router struct {
+	routes       []route
+	compoBuilder CompoBuilder
+}
+
+type route struct {
+	pattern string
+	compo   string
+}
+
+func (r *router) Route(pattern string, compo string) error {
+	if _, err := r.compoBuilder.New(compo); err != nil {
+		return errors.Wrapf(err, "fail to route %s", pattern)
+	}
+
+	r.routes = append(r.routes, route{
+		pattern: pattern,
+		compo:   compo,
+	})
+	return nil
+}
+
+func (r *router) Resolve(u url.URL) (c Componer, err error) {
+	for _, route := range r.routes {
+		params, ok := matchPattern(route.pattern, u.Path)
+		if !ok {
+			continue
+		}
+
+		if c, err = r.compoBuilder.New(route.compo); err != nil {
+			err = errors.Wrapf(err, "fail to resolve %s", u.Path)
+			return
+		}
+
+		if err = mapComponentFields(c, urlAttrs(u, params)); err != nil {
+			err = errors.Wrapf(err, "fail to resolve %s", u.Path)
+		}
+		return
+	}
+
+	err = errors.Errorf("no route for %s", u.Path)
+	return
+}
+
+func (r *router) Mount(env Env, u url.URL) (c Componer, root Tag, err error) {
+	if c, err = r.Resolve(u); err != nil {
+		return
+	}
+
+	if navigator, ok := c.(Navigator); ok {
+		navigator.OnNavigate(u)
+	}
+
+	if root, err = env.Mount(c); err != nil {
+		err = errors.Wrapf(err, "fail to navigate to %s", u.Path)
+	}
+	return
+}
+
+func (r *router) Navigate(env Env, page Componer, u url.URL) (c Componer, syncs []Sync, err error) {
+	oldRoot, err := env.Root(page)
+	if err != nil {
+		err = errors.Wrapf(err, "fail to navigate to %s", u.Path)
+		return
+	}
+
+	var root Tag
+	if c, root, err = r.Mount(env, u); err != nil {
+		return
+	}
+	env.Dismount(page)
+
+	syncs = []Sync{
+		{
+			Op:  SyncReplace,
+			Tag: root,
+			ID:  oldRoot.ID,
+		},
+	}
+	return
+}
@@ -0,0 +1,190 @@
+package markup
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestRouter(t *testing.T) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, r Router, env Env)
+	}{
+		{
+			name: "route not registered component",
+			test: testRouterRouteNotRegistered,
+		},
+		{
+			name: "resolve",
+			test: testRouterResolve,
+		},
+		{
+			name: "resolve without route",
+			test: testRouterResolveNotFound,
+		},
+		{
+			name: "resolve with bad param",
+			test: testRouterResolveBadParam,
+		},
+		{
+			name: "mount",
+			test: testRouterMount,
+		},
+		{
+			name: "navigate",
+			test: testRouterNavigate,
+		},
+		{
+			name: "navigate from not mounted page",
+			test: testRouterNavigateNotMounted,
+		},
+		{
+			name: "navigate to not found page",
+			test: testRouterNavigateNotFound,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b := NewCompoBuilder()
+			b.Register(&Page{})
+			b.Register(&World{})
+			b.Register(&Hello{})
+
+			r := NewRouter(b)
+			if err := r.Route("/users/{id}", "markup.page"); err != nil {
+				t.Fatal(err)
+			}
+			if err := r.Route("/", "markup.hello"); err != nil {
+				t.Fatal(err)
+			}
+
+			test.test(t, r, NewEnv(b))
+		})
+	}
+}
+
+func testRouterRouteNotRegistered(t *testing.T, r Router, env Env) {
+	err := r.Route("/foo", "markup.foo")
+	if err == nil {
+		t.Fatal("err should not be nil")
+	}
+	t.Log(err)
+}
+
+func testRouterResolve(t *testing.T, r Router, env Env) {
+	c, err := r.Resolve(url.URL{Path: "/users/42", RawQuery: "name=Max"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	page, ok := c.(*Page)
+	if !ok {
+		t.Fatalf("c should be a *Page: %T", c)
+	}
+	if page.ID != 42 {
+		t.Fatal("page.ID should be 42:", page.ID)
+	}
+	if page.Name != "Max" {
+		t.Fatal("page.Name should be Max:", page.Name)
+	}
+	if page.navigated {
+		t.Fatal("page should not be navigated")
+	}
+
+	if c, err = r.Resolve(url.URL{Path: "/"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok = c.(*Hello); !ok {
+		t.Fatalf("c should be a *Hello: %T", c)
+	}
+}
+
+func testRouterResolveNotFound(t *testing.T, r Router, env Env) {
+	_, err := r.Resolve(url.URL{Path: "/users"})
+	if err == nil {
+		t.Fatal("err should not be nil")
+	}
+	t.Log(err)
+}
+
+func testRouterResolveBadParam(t *testing.T, r Router, env Env) {
+	_, err := r.Resolve(url.URL{Path: "/users/max"})
+	if err == nil {
+		t.Fatal("err should not be nil")
+	}
+	t.Log(err)
+}
+
+func testRouterMount(t *testing.T, r Router, env Env) {
+	c, root, err := r.Mount(env, url.URL{Path: "/users/42"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.Dismount(c)
+
+	if !c.(*Page).navigated {
+		t.Fatal("page should be navigated")
+	}
+
+	if mounted, _ := env.Component(root.CompoID); mounted != c {
+		t.Fatal("page should be mounted")
+	}
+}
+
+func testRouterNavigate(t *testing.T, r Router, env Env) {
+	page, oldRoot, err := r.Mount(env, url.URL{Path: "/users/42"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, syncs, err := r.Navigate(env, page, url.URL{Path: "/users/21"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.Dismount(c)
+
+	if _, err = env.Root(page); err == nil {
+		t.Fatal("previous page should be dismounted")
+	}
+
+	if id := c.(*Page).ID; id != 21 {
+		t.Fatal("page.ID should be 21:", id)
+	}
+
+	root, err := env.Root(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if l := len(syncs); l != 1 {
+		t.Fatal("syncs should have 1 element:", l)
+	}
+	if s := syncs[0]; s.Op != SyncReplace || s.ID != oldRoot.ID || s.Tag.ID != root.ID {
+		t.Fatalf("sync should replace the previous page root: %+v", s)
+	}
+}
+
+func testRouterNavigateNotMounted(t *testing.T, r Router, env Env) {
+	_, _, err := r.Navigate(env, &Page{}, url.URL{Path: "/users/21"})
+	if err == nil {
+		t.Fatal("err should not be nil")
+	}
+	t.Log(err)
+}
+
+func testRouterNavigateNotFound(t *testing.T, r Router, env Env) {
+	page, _, err := r.Mount(env, url.URL{Path: "/users/42"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.Dismount(page)
+
+	if _, _, err = r.Navigate(env, page, url.URL{Path: "/users"}); err == nil {
+		t.Fatal("err should not be nil")
+	}
+
+	if _, err = env.Root(page); err != nil {
+		t.Fatal("page should stay mounted:", err)
+	}
+}
@@ -0,0 +1,144 @@
+package markup
+
+import (
+	"sync"
+	"time"
+)
+
+// SessionManager is the interface that describes a set of environments where
+// each environment belongs to a browser session.
+//
+// SessionManager methods are safe for concurrent use.
+type SessionManager interface {
+	// Env returns the environment of the session identified by id.
+	// The environment is created if the session does not exist.
+	// The session is marked as active.
+	Env(id string) Env
+
+	// Lookup returns the environment of the session identified by id.
+	// ok is false if the session does not exist.
+	// The session is marked as active.
+	Lookup(id string) (env Env, ok bool)
+
+	// Expire removes the session identified by id and dismounts every
+	// component mounted in its environment.
+	// It should be called when the user disconnects.
+	Expire(id string)
+
+	// ExpireIdle expires the sessions that have not been active for the
+	// duration d. It returns the number of expired sessions.
+	// It should be called periodically in order to clean up the sessions of
+	// users that went idle.
+	ExpireIdle(d time.Duration) (expired int)
+
+	// Len returns the number of live sessions.
+	Len() int
+
+	// ComponentCount returns the number of components mounted in the
+	// environments of the live sessions.
+	ComponentCount() int
+}
+
+// NewSessionManager creates a session manager.
+// Environments are created with NewEnv, b and opts.
+func NewSessionManager(b CompoBuilder, opts ...EnvOption) SessionManager {
+	return newSessionManager(b, opts...)
+}
+
+func newSessionManager(b CompoBuilder, opts ...EnvOption) *sessionManager {
+	return &sessionManager{
+		sessions:     make(map[string]*session),
+		compoBuilder: b,
+		envOptions:   opts,
+		now:          time.Now,
+	}
+}
+
+type sessionManager struct {
+	mutex        sync.Mutex
+	sessions     map[string]*session
+	compoBuilder CompoBuilder
+	envOptions   []EnvOption
+	now          func() time.Time
+}
+
+type session struct {
+	env        *env
+	lastActive time.Time
+}
+
+func (m *sessionManager) Env(id string) Env {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	s, ok := m.sessions[id]
+	if !ok {
+		s = &session{env: newEnv(m.compoBuilder, m.envOptions...)}
+		m.sessions[id] = s
+	}
+
+	s.lastActive = m.now()
+	return s.env
+}
+
+func (m *sessionManager) Lookup(id string) (env Env, ok bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	s, ok := m.sessions[id]
+	if !ok {
+		return
+	}
+
+	s.lastActive = m.now()
+	return s.env, true
+}
+
+func (m *sessionManager) Expire(id string) {
+	m.mutex.Lock()
+	s, ok := m.sessions[id]
+	delete(m.sessions, id)
+	m.mutex.Unlock()
+
+	if ok {
+		s.env.dismountAll()
+	}
+}
+
+func (m *sessionManager) ExpireIdle(d time.Duration) (expired int) {
+	m.mutex.Lock()
+	var idle []*session
+	now := m.now()
+
+	for id, s := range m.sessions {
+		if now.Sub(s.lastActive) >= d {
+			idle = append(idle, s)
+			delete(m.sessions, id)
+		}
+	}
+	m.mutex.Unlock()
+
+	// Components are dismounted once the manager is unlocked in order to not
+	// block other sessions while Dismounter hooks are called.
+	for _, s := range idle {
+		s.env.dismountAll()
+	}
+	return len(idle)
+}
+
+func (m *sessionManager) Len() int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return len(m.sessions)
+}
+
+func (m *sessionManager) ComponentCount() (count int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for _, s := range m.sessions {
+		count += s.env.componentCount()
+	}
+	return
+}
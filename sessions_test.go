@@ -0,0 +1,141 @@
+package markup
+
+import (
+	"testing"
+	"time"
+)
+
+type SessionPage struct {
+	dismounted bool
+}
+
+func (p *SessionPage) OnDismount() {
+	p.dismounted = true
+}
+
+func (p *SessionPage) Render() string {
+	return `
+<div>
+	<markup.world name="session">
+</div>
+	`
+}
+
+func TestSessionManager(t *testing.T) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, m *sessionManager)
+	}{
+		{
+			name: "create and lookup sessions",
+			test: testSessionManagerLookup,
+		},
+		{
+			name: "expire session",
+			test: testSessionManagerExpire,
+		},
+		{
+			name: "expire idle sessions",
+			test: testSessionManagerExpireIdle,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b := NewCompoBuilder()
+			b.Register(&SessionPage{})
+			b.Register(&World{})
+
+			test.test(t, newSessionManager(b))
+		})
+	}
+}
+
+func testSessionManagerLookup(t *testing.T, m *sessionManager) {
+	if _, ok := m.Lookup("alice"); ok {
+		t.Fatal("alice session should not exist")
+	}
+
+	env := m.Env("alice")
+	if env != m.Env("alice") {
+		t.Fatal("alice env should be the same")
+	}
+	if env == m.Env("bob") {
+		t.Fatal("alice and bob envs should be different")
+	}
+
+	if lookedUp, ok := m.Lookup("alice"); !ok || lookedUp != env {
+		t.Fatal("alice env should be looked up")
+	}
+
+	if l := m.Len(); l != 2 {
+		t.Fatal("sessions should be 2:", l)
+	}
+
+	if _, err := env.Mount(&SessionPage{}); err != nil {
+		t.Fatal(err)
+	}
+	if count := m.ComponentCount(); count != 2 {
+		t.Fatal("component count should be 2:", count)
+	}
+}
+
+func testSessionManagerExpire(t *testing.T, m *sessionManager) {
+	page := &SessionPage{}
+	if _, err := m.Env("alice").Mount(page); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Env("bob").Mount(&SessionPage{}); err != nil {
+		t.Fatal(err)
+	}
+
+	m.Expire("alice")
+	m.Expire("unknown")
+
+	if !page.dismounted {
+		t.Fatal("page should be dismounted")
+	}
+	if _, ok := m.Lookup("alice"); ok {
+		t.Fatal("alice session should be expired")
+	}
+	if l := m.Len(); l != 1 {
+		t.Fatal("sessions should be 1:", l)
+	}
+	if count := m.ComponentCount(); count != 2 {
+		t.Fatal("component count should be 2:", count)
+	}
+}
+
+func testSessionManagerExpireIdle(t *testing.T, m *sessionManager) {
+	now := time.Now()
+	m.now = func() time.Time { return now }
+
+	alice := &SessionPage{}
+	if _, err := m.Env("alice").Mount(alice); err != nil {
+		t.Fatal(err)
+	}
+
+	now = now.Add(time.Minute)
+	bob := &SessionPage{}
+	if _, err := m.Env("bob").Mount(bob); err != nil {
+		t.Fatal(err)
+	}
+
+	now = now.Add(time.Minute)
+	if expired := m.ExpireIdle(2 * time.Minute); expired != 1 {
+		t.Fatal("expired sessions should be 1:", expired)
+	}
+
+	if !alice.dismounted {
+		t.Fatal("alice page should be dismounted")
+	}
+	if bob.dismounted {
+		t.Fatal("bob page should not be dismounted")
+	}
+	if _, ok := m.Lookup("bob"); !ok {
+		t.Fatal("bob session should not be expired")
+	}
+	if count := m.ComponentCount(); count != 2 {
+		t.Fatal("component count should be 2:", count)
+	}
+}
@@ -3,7 +3,9 @@ package markup
 import (
 	"bufio"
 	"io"
+	"sort"
 	"strings"
+	"text/template"
 
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
@@ -20,6 +22,10 @@ type Tag struct {
 	Svg      bool
 	Attrs    AttrMap
 	Children []Tag
+
+	// values contains the values passed by reference to a component, by
+	// attribute name.
+	values map[string]interface{}
 }
 
 // IsEmpty reports whether its argument t is nil.
@@ -63,6 +69,12 @@ func (t *Tag) IsVoidElem() bool {
 	return ok
 }
 
+// isRawTextElem reports whether t is an element whose text is not decoded by
+// browsers.
+func isRawTextElem(t *Tag) bool {
+	return (t.Name == "script" || t.Name == "style") && !t.Svg
+}
+
 var (
 	voidElems = map[string]struct{}{
 		"area":   {},
@@ -122,6 +134,10 @@ type tagEncoder struct {
 	w   *bufio.Writer
 	env Env
 	svg bool
+
+	// compoIDs contains the ids of the components whose root is the next
+	// encoded tag.
+	compoIDs []uuid.UUID
 }
 
 func (e *tagEncoder) Encode(t Tag) error {
@@ -133,8 +149,7 @@ func (e *tagEncoder) Encode(t Tag) error {
 
 func (e *tagEncoder) encode(t Tag, indent int) error {
 	if t.IsText() {
-		e.encodeIndent(indent)
-		e.w.WriteString(t.Text)
+		e.encodeText(t, indent, false)
 		return nil
 	}
 
@@ -159,8 +174,15 @@ func (e *tagEncoder) encode(t Tag, indent int) error {
 		return nil
 	}
 
+	rawText := isRawTextElem(&t)
+
 	for _, child := range t.Children {
 		e.w.WriteRune('\n')
+
+		if child.IsText() {
+			e.encodeText(child, indent+1, rawText)
+			continue
+		}
 		e.encode(child, indent+1)
 	}
 
@@ -172,6 +194,20 @@ func (e *tagEncoder) encode(t Tag, indent int) error {
 	return nil
 }
 
+// encodeText writes the text t, HTML escaped unless raw is true.
+// Texts of raw text elements are not escaped since browsers do not decode
+// them.
+func (e *tagEncoder) encodeText(t Tag, indent int, raw bool) {
+	e.compoIDs = e.compoIDs[:0]
+	e.encodeIndent(indent)
+
+	if raw {
+		e.w.WriteString(t.Text)
+		return
+	}
+	e.w.WriteString(html.EscapeString(t.Text))
+}
+
 func (e *tagEncoder) encodeComponent(t Tag, indent int) error {
 	c, err := e.env.Component(t.ID)
 	if err != nil {
@@ -179,11 +215,26 @@ func (e *tagEncoder) encodeComponent(t Tag, indent int) error {
 	}
 
 	root, _ := e.env.Root(c)
+	e.compoIDs = append(e.compoIDs, t.ID)
 	return e.encode(root, indent)
 }
 
+// encodeAttributes writes the attributes of t, sorted by name in order to
+// produce the same output for the same tag.
+// Values are HTML escaped. Event handler names are also JavaScript escaped
+// since they are written in a JavaScript string.
+// The id of t is written in data-go-id. When t is the root of components, the
+// ids of the component tags are written in data-go-compo-id.
 func (e *tagEncoder) encodeAttributes(t Tag) {
-	for k, v := range t.Attrs {
+	keys := make([]string, 0, len(t.Attrs))
+	for k := range t.Attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		v := t.Attrs[k]
+
 		if len(v) == 0 {
 			e.w.WriteRune(' ')
 			e.w.WriteString(k)
@@ -196,7 +247,7 @@ func (e *tagEncoder) encodeAttributes(t Tag) {
 			e.w.WriteString(`="CallGoHandler('`)
 			e.w.WriteString(t.CompoID.String())
 			e.w.WriteString(`', '`)
-			e.w.WriteString(v)
+			e.w.WriteString(html.EscapeString(template.JSEscapeString(v)))
 			e.w.WriteString(`', this, event)"`)
 			continue
 		}
@@ -204,13 +255,29 @@ func (e *tagEncoder) encodeAttributes(t Tag) {
 		e.w.WriteRune(' ')
 		e.w.WriteString(k)
 		e.w.WriteString(`="`)
-		e.w.WriteString(v)
+		e.w.WriteString(html.EscapeString(v))
 		e.w.WriteString(`"`)
 	}
 
 	e.w.WriteString(` data-go-id="`)
 	e.w.WriteString(t.ID.String())
 	e.w.WriteString(`"`)
+
+	if len(e.compoIDs) != 0 {
+		e.w.WriteString(` data-go-compo-id="`)
+		e.w.WriteString(joinIDs(e.compoIDs))
+		e.w.WriteString(`"`)
+		e.compoIDs = e.compoIDs[:0]
+	}
+}
+
+// joinIDs returns the ids separated by spaces.
+func joinIDs(ids []uuid.UUID) string {
+	s := make([]string, len(ids))
+	for i, id := range ids {
+		s[i] = id.String()
+	}
+	return strings.Join(s, " ")
 }
 
 func (e *tagEncoder) encodeIndent(indent int) {
@@ -222,6 +289,10 @@ func (e *tagEncoder) encodeIndent(indent int) {
 // TagDecoder is the interface that describes a decoder that can read HTML5 code
 // and translate it to a Tag tree.
 // Additionally, HTML5 can embed custom component tags.
+//
+// Component tags are not closed unless they have children: a component tag
+// followed by its end tag, before the end of its parent, has the tags in
+// between as children.
 type TagDecoder interface {
 	Decode(t *Tag) error
 }
@@ -237,6 +308,68 @@ type tagDecoder struct {
 	tokenizer *html.Tokenizer
 	svg       bool
 	err       error
+
+	// tokens contains the tokens read from the tokenizer. They are buffered
+	// in order to look for the end tags of components.
+	tokens []token
+	pos    int
+
+	// compoEnds contains the positions of the end tags of the components, by
+	// position of their children. It is nil until the first component is
+	// decoded.
+	compoEnds map[int]int
+}
+
+type token struct {
+	typ   html.TokenType
+	name  string
+	text  string
+	attrs AttrMap
+}
+
+// peek returns the token at the position i, reading it from the tokenizer if
+// necessary.
+func (d *tagDecoder) peek(i int) token {
+	for len(d.tokens) <= i {
+		if n := len(d.tokens); n != 0 && d.tokens[n-1].typ == html.ErrorToken {
+			return d.tokens[n-1]
+		}
+		d.tokens = append(d.tokens, d.readToken())
+	}
+	return d.tokens[i]
+}
+
+func (d *tagDecoder) readToken() (tok token) {
+	tok.typ = d.tokenizer.Next()
+
+	switch tok.typ {
+	case html.StartTagToken, html.EndTagToken, html.SelfClosingTagToken:
+		bname, hasAttr := d.tokenizer.TagName()
+		tok.name = string(bname)
+
+		if !hasAttr {
+			return
+		}
+
+		tok.attrs = make(AttrMap)
+		for {
+			key, val, more := d.tokenizer.TagAttr()
+			tok.attrs[string(key)] = string(val)
+			if !more {
+				break
+			}
+		}
+
+	case html.TextToken:
+		tok.text = string(d.tokenizer.Text())
+	}
+	return
+}
+
+func (d *tagDecoder) next() token {
+	tok := d.peek(d.pos)
+	d.pos++
+	return tok
 }
 
 func (d *tagDecoder) Decode(t *Tag) error {
@@ -250,18 +383,20 @@ func (d *tagDecoder) Decode(t *Tag) error {
 }
 
 func (d *tagDecoder) decode(t *Tag) bool {
-	switch d.tokenizer.Next() {
+	tok := d.next()
+
+	switch tok.typ {
 	case html.StartTagToken:
-		return d.decodeTag(t)
+		return d.decodeTag(t, tok)
 
 	case html.EndTagToken:
-		return d.decodeEndTag(t)
+		return d.decodeEndTag(t, tok)
 
 	case html.TextToken:
-		return d.decodeText(t)
+		return d.decodeText(t, tok)
 
 	case html.SelfClosingTagToken:
-		return d.decodeSelfClosingTag(t)
+		return d.decodeSelfClosingTag(t, tok)
 
 	case html.ErrorToken:
 		return false
@@ -269,21 +404,21 @@ func (d *tagDecoder) decode(t *Tag) bool {
 	return d.decode(t)
 }
 
-func (d *tagDecoder) decodeTag(t *Tag) bool {
-	bname, hasAttr := d.tokenizer.TagName()
-	name := string(bname)
+func (d *tagDecoder) decodeTag(t *Tag, tok token) bool {
+	name := tok.name
 	t.Name = name
 
 	if name == "svg" {
 		d.svg = true
 	}
 	t.Svg = d.svg
+	t.Attrs = tok.attrs
 
-	if hasAttr {
-		d.decodeAttrs(t)
+	if t.IsVoidElem() {
+		return true
 	}
 
-	if t.IsComponent() || t.IsVoidElem() {
+	if t.IsComponent() && d.componentEnd(d.pos) == -1 {
 		return true
 	}
 
@@ -303,31 +438,90 @@ func (d *tagDecoder) decodeTag(t *Tag) bool {
 	}
 }
 
-func (d *tagDecoder) decodeAttrs(t *Tag) {
-	attrs := make(AttrMap)
-	for {
-		key, val, more := d.tokenizer.TagAttr()
-		attrs[string(key)] = string(val)
-		if !more {
-			break
-		}
+// componentEnd returns the position of the end tag of the component whose
+// children start at the position pos, or -1 if the component is not closed.
+func (d *tagDecoder) componentEnd(pos int) int {
+	if d.compoEnds == nil {
+		d.scanComponentEnds()
 	}
-	t.Attrs = attrs
+
+	if end, ok := d.compoEnds[pos]; ok {
+		return end
+	}
+	return -1
 }
 
-func (d *tagDecoder) decodeEndTag(t *Tag) bool {
-	bname, _ := d.tokenizer.TagName()
-	name := string(bname)
+// scanComponentEnds reads all the tokens and finds the end tags of the
+// components in a single pass.
+// A component is closed by the first unmatched end tag that follows it if it
+// has the component name. Otherwise, the component is not closed and the end
+// tag closes its parent.
+func (d *tagDecoder) scanComponentEnds() {
+	type openTag struct {
+		name  string
+		pos   int
+		compo bool
+	}
+
+	d.compoEnds = make(map[int]int)
+	var stack []openTag
+	svg := false
+
+	for i := 0; ; i++ {
+		tok := d.peek(i)
+
+		switch tok.typ {
+		case html.StartTagToken:
+			if tok.name == "svg" {
+				svg = true
+			}
+
+			t := Tag{Name: tok.name, Svg: svg}
+			if t.IsVoidElem() {
+				continue
+			}
+
+			stack = append(stack, openTag{
+				name:  tok.name,
+				pos:   i + 1,
+				compo: t.IsComponent(),
+			})
+
+		case html.EndTagToken:
+			if tok.name == "svg" {
+				svg = false
+			}
+
+			for len(stack) != 0 {
+				top := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+
+				if !top.compo {
+					break
+				}
+
+				if top.name == tok.name {
+					d.compoEnds[top.pos] = i
+					break
+				}
+				d.compoEnds[top.pos] = -1
+			}
+
+		case html.ErrorToken:
+			return
+		}
+	}
+}
 
-	if name == "svg" {
+func (d *tagDecoder) decodeEndTag(t *Tag, tok token) bool {
+	if tok.name == "svg" {
 		d.svg = false
 	}
 	return true
 }
 
-func (d *tagDecoder) decodeSelfClosingTag(t *Tag) bool {
-	bname, hasAttr := d.tokenizer.TagName()
-	name := string(bname)
+func (d *tagDecoder) decodeSelfClosingTag(t *Tag, tok token) bool {
+	name := tok.name
 
 	if !d.svg || name == "svg" {
 		d.err = errors.Errorf("%s should not be a self closing tag", name)
@@ -336,16 +530,12 @@ func (d *tagDecoder) decodeSelfClosingTag(t *Tag) bool {
 
 	t.Name = name
 	t.Svg = true
-
-	if hasAttr {
-		d.decodeAttrs(t)
-	}
+	t.Attrs = tok.attrs
 	return true
 }
 
-func (d *tagDecoder) decodeText(t *Tag) bool {
-	text := string(d.tokenizer.Text())
-	text = strings.TrimSpace(text)
+func (d *tagDecoder) decodeText(t *Tag, tok token) bool {
+	text := strings.TrimSpace(tok.text)
 
 	// There is no need to have empty text tag. If it is the case we try to
 	// decode the next tag.
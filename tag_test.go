@@ -2,6 +2,7 @@ package markup
 
 import (
 	"bytes"
+	"strings"
 	"testing"
 )
 
@@ -138,6 +139,133 @@ func TestTagEncoderEncode(t *testing.T) {
 	t.Log(err)
 }
 
+func TestTagEncoderEscape(t *testing.T) {
+	tag := Tag{
+		Name: "div",
+		Attrs: AttrMap{
+			"title":   `"hello" <world> & 'bye'`,
+			"onclick": `Do', this); alert("42`,
+		},
+		Children: []Tag{
+			{Text: `1 < 2 && "3" > '0'`},
+			{Text: "</div><script>alert(42)</script>"},
+		},
+	}
+
+	w := &bytes.Buffer{}
+	enc := NewTagEncoder(w, nil)
+	if err := enc.Encode(tag); err != nil {
+		t.Fatal(err)
+	}
+	t.Log(w.String())
+
+	dec := NewTagDecoder(w)
+	root := Tag{}
+	if err := dec.Decode(&root); err != nil {
+		t.Fatal(err)
+	}
+
+	if title := root.Attrs["title"]; title != tag.Attrs["title"] {
+		t.Errorf(`title should be "%s": "%s"`, tag.Attrs["title"], title)
+	}
+
+	onclick := `CallGoHandler('00000000-0000-0000-0000-000000000000', 'Do\', this); alert(\"42', this, event)`
+	if handler := root.Attrs["onclick"]; handler != onclick {
+		t.Errorf(`onclick should be "%s": "%s"`, onclick, handler)
+	}
+
+	if l := len(root.Children); l != 1 {
+		t.Fatal("root should have 1 child:", l)
+	}
+
+	text := tag.Children[0].Text + "\n  " + tag.Children[1].Text
+	if child := root.Children[0]; child.Text != text {
+		t.Errorf(`child should be the text "%s": "%s"`, text, child.Text)
+	}
+}
+
+func TestTagEncoderRawText(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+	}{
+		{
+			name: "script",
+			text: `if (a < b && c) { console.log("<p>&amp;</p>"); }`,
+		},
+		{
+			name: "style",
+			text: `p > a { content: "&"; }`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tag := Tag{
+				Name: "div",
+				Children: []Tag{
+					{
+						Name:     test.name,
+						Children: []Tag{{Text: test.text}},
+					},
+				},
+			}
+
+			w := &bytes.Buffer{}
+			enc := NewTagEncoder(w, nil)
+			if err := enc.Encode(tag); err != nil {
+				t.Fatal(err)
+			}
+			t.Log(w.String())
+
+			if !strings.Contains(w.String(), test.text) {
+				t.Fatalf("encoded tag should contain %s: %s", test.text, w.String())
+			}
+
+			dec := NewTagDecoder(w)
+			root := Tag{}
+			if err := dec.Decode(&root); err != nil {
+				t.Fatal(err)
+			}
+
+			elem := root.Children[0]
+			if l := len(elem.Children); l != 1 {
+				t.Fatalf("%s should have 1 child: %d", test.name, l)
+			}
+			if text := strings.TrimSpace(elem.Children[0].Text); text != test.text {
+				t.Errorf(`%s text should be "%s": "%s"`, test.name, test.text, text)
+			}
+		})
+	}
+}
+
+func TestTagEncoderAttributesOrder(t *testing.T) {
+	tag := Tag{
+		Name: "input",
+		Attrs: AttrMap{
+			"type":        "text",
+			"placeholder": "name",
+			"required":    "",
+			"autofocus":   "",
+			"class":       "field",
+			"onchange":    "Name",
+		},
+	}
+
+	html := `<input autofocus class="field" onchange="CallGoHandler('00000000-0000-0000-0000-000000000000', 'Name', this, event)" placeholder="name" required type="text" data-go-id="00000000-0000-0000-0000-000000000000">`
+
+	for i := 0; i < 10; i++ {
+		w := &bytes.Buffer{}
+		enc := NewTagEncoder(w, nil)
+		if err := enc.Encode(tag); err != nil {
+			t.Fatal(err)
+		}
+		if w.String() != html {
+			t.Fatalf("encoded tag should be %s: %s", html, w.String())
+		}
+	}
+}
+
 func BenchmarkTagEncoder(b *testing.B) {
 	bui := NewCompoBuilder()
 	bui.Register(&Hello{})
@@ -287,6 +415,77 @@ func testDecodeCheckSvg(t *testing.T, tag Tag) {
 	}
 }
 
+func TestDecodeComponentChildren(t *testing.T) {
+	h := `
+<div>
+	<lib.card title="a">
+		<h1 slot="header">hello</h1>
+		<lib.card title="b">
+			<p>nested</p>
+		</lib.card>
+		<lib.world name="unclosed">
+		<p>world</p>
+	</lib.card>
+	<lib.world name="unclosed">
+	<p>
+		<lib.world name="unclosed">
+	</p>
+	<span>after</span>
+</div>
+	`
+
+	d := NewTagDecoder(bytes.NewBufferString(h))
+	root := Tag{}
+	if err := d.Decode(&root); err != nil {
+		t.Fatal(err)
+	}
+
+	if l := len(root.Children); l != 4 {
+		t.Fatal("root should have 4 children:", l)
+	}
+
+	card := root.Children[0]
+	if l := len(card.Children); l != 4 {
+		t.Fatal("card should have 4 children:", l)
+	}
+	if name := card.Children[1].Name; name != "lib.card" {
+		t.Fatal("card second child should be lib.card:", name)
+	}
+	if l := len(card.Children[1].Children); l != 1 {
+		t.Fatal("nested card should have 1 child:", l)
+	}
+	if l := len(card.Children[2].Children); l != 0 {
+		t.Fatal("unclosed component should not have children:", l)
+	}
+
+	if l := len(root.Children[1].Children); l != 0 {
+		t.Fatal("unclosed component should not have children:", l)
+	}
+	if l := len(root.Children[2].Children); l != 1 {
+		t.Fatal("p should have 1 child:", l)
+	}
+	if name := root.Children[3].Name; name != "span" {
+		t.Fatal("root last child should be span:", name)
+	}
+}
+
+func BenchmarkDecodeUnclosedComponents(b *testing.B) {
+	var h bytes.Buffer
+	h.WriteString("<div>")
+	for i := 0; i < 2000; i++ {
+		h.WriteString(`<lib.row index="42">`)
+	}
+	h.WriteString("</div>")
+
+	for i := 0; i < b.N; i++ {
+		d := NewTagDecoder(bytes.NewReader(h.Bytes()))
+		root := Tag{}
+		if err := d.Decode(&root); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
 func TestDecodeSelfClosingTagError(t *testing.T) {
 	h := `
 <p>
@@ -0,0 +1,208 @@
+// Minimal DOM used to test the runtime served by Bridge.
+//
+// It only implements what the runtime uses. The page is built with __mount,
+// messages from the bridge are simulated with __receive and the page is read
+// back with __dump.
+var window = this;
+var sent = [];
+var events = [];
+var errors = [];
+
+function Node(type) {
+  this.nodeType = type;
+  this.parentNode = null;
+  this.childNodes = [];
+}
+
+Node.prototype.appendChild = function (child) {
+  return this.insertBefore(child, null);
+};
+
+Node.prototype.insertBefore = function (child, ref) {
+  if (child.parentNode) {
+    child.parentNode.removeChild(child);
+  }
+
+  var i = ref ? this.childNodes.indexOf(ref) : this.childNodes.length;
+  if (i < 0) {
+    throw new Error('insertBefore: reference is not a child');
+  }
+
+  this.childNodes.splice(i, 0, child);
+  child.parentNode = this;
+  return child;
+};
+
+Node.prototype.removeChild = function (child) {
+  var i = this.childNodes.indexOf(child);
+  if (i < 0) {
+    throw new Error('removeChild: node is not a child');
+  }
+
+  this.childNodes.splice(i, 1);
+  child.parentNode = null;
+  return child;
+};
+
+Node.prototype.replaceChild = function (child, old) {
+  this.insertBefore(child, old);
+  return this.removeChild(old);
+};
+
+function Element(name, ns) {
+  Node.call(this, 1);
+  this.nodeName = name;
+  this.namespaceURI = ns || 'http://www.w3.org/1999/xhtml';
+  this.attrs = {};
+}
+
+Element.prototype = Object.create(Node.prototype);
+
+Element.prototype.getAttribute = function (name) {
+  return name in this.attrs ? this.attrs[name] : null;
+};
+
+Element.prototype.setAttribute = function (name, value) {
+  this.attrs[name] = String(value);
+};
+
+Element.prototype.removeAttribute = function (name) {
+  delete this.attrs[name];
+};
+
+Element.prototype.getAttributeNames = function () {
+  return Object.keys(this.attrs);
+};
+
+function Text(value) {
+  Node.call(this, 3);
+  this.nodeValue = value;
+}
+
+Text.prototype = Object.create(Node.prototype);
+
+function find(node, match) {
+  if (node.nodeType === 1 && match(node)) {
+    return node;
+  }
+
+  for (var i = 0; i < node.childNodes.length; i++) {
+    var found = find(node.childNodes[i], match);
+    if (found) {
+      return found;
+    }
+  }
+  return null;
+}
+
+var body = new Element('body');
+
+var document = {
+  body: body,
+  currentScript: { src: 'http://localhost/bridge' },
+
+  createElement: function (name) {
+    return new Element(name);
+  },
+
+  createElementNS: function (ns, name) {
+    return new Element(name, ns);
+  },
+
+  createTextNode: function (value) {
+    return new Text(value);
+  },
+
+  // querySelector only supports [name="value"] and [name~="value"].
+  querySelector: function (selector) {
+    var m = /^\[([\w-]+)(~?)="([^"]*)"\]$/.exec(selector);
+    if (!m) {
+      throw new Error('querySelector: unsupported selector ' + selector);
+    }
+
+    return find(body, function (el) {
+      var v = el.getAttribute(m[1]);
+      if (v === null) {
+        return false;
+      }
+      return m[2] ? v.split(' ').indexOf(m[3]) >= 0 : v === m[3];
+    });
+  }
+};
+
+function WebSocket(url) {
+  this.url = url;
+  this.readyState = WebSocket.OPEN;
+  window.socket = this;
+}
+
+WebSocket.OPEN = 1;
+
+WebSocket.prototype.send = function (msg) {
+  sent.push(msg);
+};
+
+function CustomEvent(type, init) {
+  this.type = type;
+  this.detail = init.detail;
+}
+
+window.dispatchEvent = function (e) {
+  events.push(e);
+};
+
+var console = {
+  error: function (err) {
+    errors.push(String(err));
+  }
+};
+
+function __build(node) {
+  if (!node.Name) {
+    return new Text(node.Text || '');
+  }
+
+  var el = new Element(node.Name, node.Svg ? 'http://www.w3.org/2000/svg' : null);
+  for (var name in node.Attrs || {}) {
+    el.setAttribute(name, node.Attrs[name]);
+  }
+
+  (node.Children || []).forEach(function (child) {
+    el.appendChild(new Text('\n  '));
+    el.appendChild(__build(child));
+  });
+  return el;
+}
+
+function __mount(node) {
+  body.childNodes = [];
+  body.appendChild(__build(JSON.parse(node)));
+}
+
+function __receive(data) {
+  socket.onmessage({ data: data });
+}
+
+function __dumpNode(node) {
+  if (node.nodeType === 3) {
+    return { Text: node.nodeValue };
+  }
+
+  var children = node.childNodes.filter(function (child) {
+    return child.nodeType === 1 || child.nodeValue.trim().length !== 0;
+  });
+
+  var n = {
+    Name: node.nodeName,
+    Svg: node.namespaceURI === 'http://www.w3.org/2000/svg',
+    Attrs: node.attrs
+  };
+  if (children.length) {
+    n.Children = children.map(__dumpNode);
+  }
+  return n;
+}
+
+function __dump() {
+  return JSON.stringify(__dumpNode(body.childNodes[0]));
+}
@@ -0,0 +1,177 @@
+package markup
+
+import (
+	"strings"
+	"text/template"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// WireSync is the JSON representation of a sync operation, as applied to the
+// DOM by the JavaScript runtime served by Bridge.
+//
+// Tags are located in the DOM by their id, written in the data-go-id
+// attribute. Component tags are located by the data-go-compo-id attribute of
+// their root. Children are located by their position among the element and
+// non blank text nodes of their parent.
+type WireSync struct {
+	// Op is the kind of the operation: tag, insert, move, remove, setAttr,
+	// removeAttr, setText or replace.
+	Op string
+
+	ID       string `json:",omitempty"`
+	ParentID string `json:",omitempty"`
+	Index    int
+	OldIndex int  `json:",omitempty"`
+	Full     bool `json:",omitempty"`
+	Attr     string
+	Value    string
+
+	// Node is the node to create for tag, insert and replace operations.
+	// It only contains the attributes to set for tag operations that are not
+	// full.
+	Node *WireNode `json:",omitempty"`
+}
+
+// WireNode is the JSON representation of a tag, as created in the DOM by the
+// JavaScript runtime served by Bridge.
+// Component tags are represented by the node of their root.
+// Attributes are the ones written by TagEncoder.
+type WireNode struct {
+	Name     string            `json:",omitempty"`
+	Text     string            `json:",omitempty"`
+	Svg      bool              `json:",omitempty"`
+	Attrs    map[string]string `json:",omitempty"`
+	Children []WireNode        `json:",omitempty"`
+}
+
+var wireSyncOps = map[SyncOp]string{
+	SyncTag:        "tag",
+	SyncInsert:     "insert",
+	SyncMove:       "move",
+	SyncRemove:     "remove",
+	SyncSetAttr:    "setAttr",
+	SyncRemoveAttr: "removeAttr",
+	SyncSetText:    "setText",
+	SyncReplace:    "replace",
+}
+
+// NewWireSyncs returns the JSON representation of syncs.
+// env is the environment where the synced components are mounted.
+func NewWireSyncs(env Env, syncs []Sync) ([]WireSync, error) {
+	wsyncs := make([]WireSync, len(syncs))
+
+	for i, s := range syncs {
+		ws := WireSync{
+			Op:       wireSyncOps[s.Op],
+			ID:       wireID(s.ID),
+			ParentID: wireID(s.ParentID),
+			Index:    s.Index,
+			OldIndex: s.OldIndex,
+			Full:     s.Full,
+			Attr:     s.Attr,
+			Value:    s.Value,
+		}
+
+		switch s.Op {
+		case SyncTag:
+			ws.ID = wireID(s.Tag.ID)
+			if !s.Full {
+				ws.Node = &WireNode{
+					Name:  s.Tag.Name,
+					Svg:   s.Tag.Svg,
+					Attrs: wireAttrs(s.Tag, nil),
+				}
+				break
+			}
+			fallthrough
+
+		case SyncInsert, SyncReplace:
+			node, err := NewWireNode(env, s.Tag)
+			if err != nil {
+				return nil, errors.Wrap(err, "fail to encode syncs")
+			}
+			ws.Node = &node
+
+		case SyncSetAttr:
+			if len(s.Value) != 0 && strings.HasPrefix(s.Attr, "on") {
+				ws.Value = eventHandlerCall(s.CompoID, s.Value)
+			}
+		}
+
+		wsyncs[i] = ws
+	}
+	return wsyncs, nil
+}
+
+// NewWireNode returns the JSON representation of t.
+// env is the environment where the components described in t are mounted.
+func NewWireNode(env Env, t Tag) (WireNode, error) {
+	return newWireNode(env, t, nil)
+}
+
+func newWireNode(env Env, t Tag, compoIDs []uuid.UUID) (n WireNode, err error) {
+	if t.IsText() {
+		n.Text = t.Text
+		return
+	}
+
+	if t.IsComponent() {
+		var c Componer
+		if c, err = env.Component(t.ID); err != nil {
+			err = errors.Wrap(err, "can't encode component")
+			return
+		}
+
+		root, _ := env.Root(c)
+		return newWireNode(env, root, append(compoIDs, t.ID))
+	}
+
+	n.Name = t.Name
+	n.Svg = t.Svg
+	n.Attrs = wireAttrs(t, compoIDs)
+
+	if len(t.Children) != 0 {
+		n.Children = make([]WireNode, len(t.Children))
+	}
+
+	for i, child := range t.Children {
+		if n.Children[i], err = newWireNode(env, child, nil); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// wireAttrs returns the attributes of t as written by TagEncoder, without
+// escaping.
+func wireAttrs(t Tag, compoIDs []uuid.UUID) map[string]string {
+	attrs := make(map[string]string, len(t.Attrs)+2)
+
+	for k, v := range t.Attrs {
+		if len(v) != 0 && strings.HasPrefix(k, "on") {
+			v = eventHandlerCall(t.CompoID, v)
+		}
+		attrs[k] = v
+	}
+
+	attrs["data-go-id"] = t.ID.String()
+	if len(compoIDs) != 0 {
+		attrs["data-go-compo-id"] = joinIDs(compoIDs)
+	}
+	return attrs
+}
+
+// eventHandlerCall returns the JavaScript code that calls the event handler
+// named handler of the component identified by compoID.
+func eventHandlerCall(compoID uuid.UUID, handler string) string {
+	return "CallGoHandler('" + compoID.String() + "', '" + template.JSEscapeString(handler) + "', this, event)"
+}
+
+func wireID(id uuid.UUID) string {
+	if id == uuid.Nil {
+		return ""
+	}
+	return id.String()
+}
@@ -0,0 +1,424 @@
+package markup
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/dop251/goja"
+	"github.com/google/uuid"
+)
+
+// testRuntime is the runtime served by Bridge, loaded in a fake DOM.
+type testRuntime struct {
+	vm *goja.Runtime
+}
+
+func newTestRuntime(t *testing.T) testRuntime {
+	fakedom, err := ioutil.ReadFile("testdata/fakedom.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vm := goja.New()
+	if _, err = vm.RunString(string(fakedom)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = vm.RunString(runtimeJS); err != nil {
+		t.Fatal(err)
+	}
+	return testRuntime{vm: vm}
+}
+
+func (r testRuntime) call(t *testing.T, name string, args ...interface{}) goja.Value {
+	fn, ok := goja.AssertFunction(r.vm.Get(name))
+	if !ok {
+		t.Fatal(name, "should be a function")
+	}
+
+	vals := make([]goja.Value, len(args))
+	for i, arg := range args {
+		vals[i] = r.vm.ToValue(arg)
+	}
+
+	v, err := fn(goja.Undefined(), vals...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func (r testRuntime) mount(t *testing.T, n WireNode) {
+	data, err := json.Marshal(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.call(t, "__mount", string(data))
+}
+
+func (r testRuntime) receive(t *testing.T, res bridgeResponse) {
+	data, err := json.Marshal(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.call(t, "__receive", string(data))
+}
+
+func (r testRuntime) dump(t *testing.T) (n WireNode) {
+	if err := json.Unmarshal([]byte(r.call(t, "__dump").String()), &n); err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func (r testRuntime) strings(name string) []string {
+	var s []string
+	r.vm.ExportTo(r.vm.Get(name), &s)
+	return s
+}
+
+func TestRuntime(t *testing.T) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, mode SyncMode)
+	}{
+		{
+			name: "set attribute",
+			test: func(t *testing.T, mode SyncMode) {
+				testRuntimeUpdate(t, mode, &Hello{}, func(c Componer) {
+					c.(*Hello).Placeholder = `"Your name"`
+				})
+			},
+		},
+		{
+			name: "set text",
+			test: func(t *testing.T, mode SyncMode) {
+				testRuntimeUpdate(t, mode, &Hello{}, func(c Componer) {
+					c.(*Hello).Greeting = "<Hi>"
+				})
+			},
+		},
+		{
+			name: "replace tag with text",
+			test: func(t *testing.T, mode SyncMode) {
+				testRuntimeUpdate(t, mode, &Hello{}, func(c Componer) {
+					c.(*Hello).TextBye = true
+				})
+			},
+		},
+		{
+			name: "replace tag with component",
+			test: func(t *testing.T, mode SyncMode) {
+				testRuntimeUpdate(t, mode, &Hello{}, func(c Componer) {
+					c.(*Hello).Name = "Maxence"
+				})
+			},
+		},
+		{
+			name: "update nested component",
+			test: func(t *testing.T, mode SyncMode) {
+				testRuntimeUpdate(t, mode, &Hello{Name: "Max"}, func(c Componer) {
+					c.(*Hello).Name = "Maxence"
+				})
+			},
+		},
+		{
+			name: "insert move and remove keyed children",
+			test: func(t *testing.T, mode SyncMode) {
+				testRuntimeUpdate(t, mode, &KeyedList{Items: []string{"a", "b", "c", "d"}}, func(c Componer) {
+					c.(*KeyedList).Items = []string{"e", "c", "a", "d"}
+				})
+			},
+		},
+		{
+			name: "move keyed components",
+			test: func(t *testing.T, mode SyncMode) {
+				testRuntimeUpdate(t, mode, &KeyedList{Items: []string{"a", "b", "c"}, Compo: true}, func(c Componer) {
+					c.(*KeyedList).Items = []string{"c", "b", "a"}
+				})
+			},
+		},
+		{
+			name: "update projected children",
+			test: func(t *testing.T, mode SyncMode) {
+				testRuntimeUpdate(t, mode, &CardPage{Title: "Hello", Body: "World"}, func(c Componer) {
+					c.(*CardPage).Title = "Hi"
+					c.(*CardPage).Name = "Max"
+				})
+			},
+		},
+		{
+			name: "render error boundary fallback",
+			test: func(t *testing.T, mode SyncMode) {
+				testRuntimeUpdate(t, mode, &BoundaryPage{}, func(c Componer) {
+					c.(*BoundaryPage).Broken = true
+				})
+			},
+		},
+	}
+
+	modes := []struct {
+		name string
+		mode SyncMode
+	}{
+		{name: "full", mode: FullSyncMode},
+		{name: "patch", mode: PatchSyncMode},
+	}
+
+	for _, m := range modes {
+		for _, test := range tests {
+			mode := m.mode
+			t.Run(m.name+" "+test.name, func(t *testing.T) { test.test(t, mode) })
+		}
+	}
+}
+
+// testRuntimeUpdate mounts c in the fake DOM, updates it with change and
+// checks that the syncs applied by the runtime produce the DOM of the
+// updated component.
+func testRuntimeUpdate(t *testing.T, mode SyncMode, c Componer, change func(c Componer)) {
+	b := NewCompoBuilder()
+	b.Register(&Hello{})
+	b.Register(&World{})
+	b.Register(&KeyedList{})
+	b.Register(&Card{})
+	b.Register(&Boundary{})
+
+	env := NewEnv(b, WithSyncMode(mode))
+
+	root, err := env.Mount(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.Dismount(c)
+
+	rt := newTestRuntime(t)
+	node, err := NewWireNode(env, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rt.mount(t, node)
+
+	change(c)
+	syncs, err := env.Update(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wsyncs, err := NewWireSyncs(env, syncs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rt.receive(t, bridgeResponse{Syncs: wsyncs})
+
+	if errs := rt.strings("errors"); len(errs) != 0 {
+		t.Fatal("runtime should not report errors:", errs)
+	}
+
+	root, _ = env.Root(c)
+	if node, err = NewWireNode(env, root); err != nil {
+		t.Fatal(err)
+	}
+
+	if dom := rt.dump(t); !reflect.DeepEqual(dom, node) {
+		t.Fatalf("dom should be %+v: %+v", node, dom)
+	}
+}
+
+func TestRuntimeEvents(t *testing.T) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, rt testRuntime)
+	}{
+		{
+			name: "call go handler with value",
+			test: testRuntimeCallGoHandlerValue,
+		},
+		{
+			name: "call go handler with event",
+			test: testRuntimeCallGoHandlerEvent,
+		},
+		{
+			name: "dispatch syncs",
+			test: testRuntimeDispatchSyncs,
+		},
+		{
+			name: "report error",
+			test: testRuntimeReportError,
+		},
+		{
+			name: "rebuild component on error",
+			test: testRuntimeRebuildOnError,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) { test.test(t, newTestRuntime(t)) })
+	}
+}
+
+func testRuntimeCallGoHandlerValue(t *testing.T, rt testRuntime) {
+	compoID := uuid.New()
+	rt.call(t, "CallGoHandler", compoID.String(), "Name", map[string]interface{}{"value": "Max"}, map[string]interface{}{"type": "change"})
+
+	testRuntimeSent(t, rt, bridgeEvent{
+		CompoID: compoID,
+		Target:  "Name",
+		Arg:     `"Max"`,
+	})
+}
+
+func testRuntimeCallGoHandlerEvent(t *testing.T, rt testRuntime) {
+	compoID := uuid.New()
+	rt.call(t, "CallGoHandler", compoID.String(), "OnClick", map[string]interface{}{}, map[string]interface{}{"type": "click", "clientX": 42})
+
+	testRuntimeSent(t, rt, bridgeEvent{
+		CompoID: compoID,
+		Target:  "OnClick",
+		Arg:     `{"Type":"click","ClientX":42}`,
+	})
+}
+
+func testRuntimeSent(t *testing.T, rt testRuntime, expected bridgeEvent) {
+	sent := rt.strings("sent")
+	if len(sent) != 1 {
+		t.Fatal("runtime should have sent 1 message:", sent)
+	}
+
+	var ev bridgeEvent
+	if err := json.Unmarshal([]byte(sent[0]), &ev); err != nil {
+		t.Fatal(err)
+	}
+
+	if ev != expected {
+		t.Fatalf("sent event should be %+v: %+v", expected, ev)
+	}
+}
+
+func testRuntimeDispatchSyncs(t *testing.T, rt testRuntime) {
+	id := uuid.New()
+	rt.mount(t, WireNode{
+		Name:  "div",
+		Attrs: map[string]string{"data-go-id": id.String()},
+	})
+
+	rt.receive(t, bridgeResponse{Syncs: []WireSync{
+		{
+			Op:    "setAttr",
+			ID:    id.String(),
+			Attr:  "class",
+			Value: "hello",
+		},
+	}})
+
+	if n := rt.vm.Get("events").ToObject(rt.vm).Get("length").ToInteger(); n != 1 {
+		t.Fatal("runtime should have dispatched 1 event:", n)
+	}
+
+	if class := rt.dump(t).Attrs["class"]; class != "hello" {
+		t.Fatal("class should be hello:", class)
+	}
+}
+
+func testRuntimeReportError(t *testing.T, rt testRuntime) {
+	rt.receive(t, bridgeResponse{Error: "boo"})
+
+	if errs := rt.strings("errors"); len(errs) != 1 || errs[0] != "boo" {
+		t.Fatal("runtime should have reported boo:", errs)
+	}
+
+	if n := rt.vm.Get("events").ToObject(rt.vm).Get("length").ToInteger(); n != 0 {
+		t.Fatal("runtime should not have dispatched events:", n)
+	}
+}
+
+func TestNewWireSyncs(t *testing.T) {
+	compoID := uuid.New()
+	id := uuid.New()
+
+	wsyncs, err := NewWireSyncs(nil, []Sync{
+		{
+			Op:      SyncSetAttr,
+			ID:      id,
+			CompoID: compoID,
+			Attr:    "onclick",
+			Value:   "On'Click",
+		},
+		{
+			Op: SyncTag,
+			Tag: Tag{
+				Name:  "div",
+				ID:    id,
+				Attrs: AttrMap{"class": "hello"},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []WireSync{
+		{
+			Op:    "setAttr",
+			ID:    id.String(),
+			Attr:  "onclick",
+			Value: "CallGoHandler('" + compoID.String() + `', 'On\'Click', this, event)`,
+		},
+		{
+			Op: "tag",
+			ID: id.String(),
+			Node: &WireNode{
+				Name: "div",
+				Attrs: map[string]string{
+					"class":      "hello",
+					"data-go-id": id.String(),
+				},
+			},
+		},
+	}
+
+	if !reflect.DeepEqual(wsyncs, expected) {
+		t.Fatalf("wire syncs should be %+v: %+v", expected, wsyncs)
+	}
+}
+
+func testRuntimeRebuildOnError(t *testing.T, rt testRuntime) {
+	id := uuid.New()
+	compoID := uuid.New()
+	rt.mount(t, WireNode{
+		Name: "div",
+		Attrs: map[string]string{
+			"data-go-id":       id.String(),
+			"data-go-compo-id": compoID.String(),
+		},
+		Children: []WireNode{{Text: "hello"}},
+	})
+
+	rt.receive(t, bridgeResponse{
+		Error: "boo",
+		Syncs: []WireSync{
+			{
+				Op: "replace",
+				ID: id.String(),
+				Node: &WireNode{
+					Name:     "div",
+					Attrs:    map[string]string{"data-go-id": id.String()},
+					Children: []WireNode{{Text: "world"}},
+				},
+			},
+		},
+	})
+
+	if errs := rt.strings("errors"); len(errs) != 1 || errs[0] != "boo" {
+		t.Fatal("runtime should have reported boo:", errs)
+	}
+
+	dom := rt.dump(t)
+	if compoIDs := dom.Attrs["data-go-compo-id"]; compoIDs != compoID.String() {
+		t.Error("rebuilt node should keep its component ids:", compoIDs)
+	}
+	if len(dom.Children) != 1 || dom.Children[0].Text != "world" {
+		t.Errorf("rebuilt node should contain world: %+v", dom.Children)
+	}
+}